@@ -1,9 +1,9 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"regexp"
@@ -11,42 +11,22 @@ import (
 	"strings"
 	"text/tabwriter"
 	"time"
+	"unicode"
 
 	"github.com/andrew-d/go-termutil"
 	"github.com/mattn/go-colorable"
 	"github.com/mgutz/ansi"
+	"github.com/siadat/eton/eton"
 	"gopkg.in/fsnotify.v1"
 )
 
 var out = colorable.NewColorableStdout()
 
-// attrStruct holds the data fetched from a row
-// Only 1 ValueXxx field should have value, the others should be nil
+// attrStruct is an attribute loaded from the store, with the methods used
+// to display it
 type attrStruct struct {
-	// Meta
-	ID        sql.NullInt64
-	ParentID  sql.NullInt64
-	Name      sql.NullString
-	Alias     sql.NullString
-	Path      sql.NullString
-	Frequency sql.NullInt64
-	Mark      sql.NullInt64
-
-	// Values
-	ValueText sql.NullString
-	ValueBlob []byte
-	ValueInt  sql.NullInt64
-	ValueReal sql.NullFloat64
-	ValueTime time.Time
-
-	// Timestamps
-	CreatedAt  nullTime
-	UpdatedAt  nullTime
-	AccessedAt nullTime
-	DeletedAt  nullTime
-}
-
-const sqlSelect = "id, value_text, name, parent_id, alias, mark, value_blob, created_at, updated_at"
+	eton.Attr
+}
 
 // getID returns the int64 value of attr's ID.
 func (attr attrStruct) getID() int64 {
@@ -192,7 +172,7 @@ func (attr attrStruct) getValue() string {
 }
 
 // print pretty-prints attr's field values.
-func (attr attrStruct) print(w *tabwriter.Writer, verbose bool, indent int, highlighteds []string, after int) {
+func (attr attrStruct) print(w *tabwriter.Writer, verbose bool, indent int, matches matchOptions) {
 	debug := false
 
 	if debug {
@@ -227,30 +207,32 @@ func (attr attrStruct) print(w *tabwriter.Writer, verbose bool, indent int, high
 		//fmt.Fprintf(w, "%s\t", prettyAttr("name", attr.getName()))
 
 		// Value:
-		//fmt.Printf(strings.Repeat("      ", indent))
+		fmt.Fprint(out, strings.Repeat(" ", indent))
 
 		if attr.getMark() == 0 {
-			fmt.Fprintf(out, "%s: %s\n", color(attr.getIdentifier(), "yellow+b"), attr.title())
+			fmt.Fprintf(out, "%s%s: %s%s\n", color(attr.getIdentifier(), themeColor("id")), attr.prettyTags(), attr.title(), attr.prettyFileInfo())
 		} else {
 			if isOutputColored() {
-				fmt.Fprintf(out, "%s: %s\n", color(attr.getIdentifier(), "green"), color(attr.title(), "default"))
+				fmt.Fprintf(out, "%s%s: %s%s\n", color(attr.getIdentifier(), themeColor("marked")), attr.prettyTags(), color(attr.title(), "default"), attr.prettyFileInfo())
 			} else {
-				fmt.Fprintf(out, "[%s]: %s\n", attr.getIdentifier(), attr.title())
+				fmt.Fprintf(out, "[%s]%s: %s%s\n", attr.getIdentifier(), attr.prettyTags(), attr.title(), attr.prettyFileInfo())
 			}
 
 		}
-		if len(highlighteds) > 0 {
-			fmt.Fprintln(out, attr.prettyMatches(highlighteds, after))
+		if matches.pattern != nil {
+			fmt.Fprintln(out, attr.prettyMatches(matches))
 		}
 	}
 }
 
-func (attr attrStruct) prettyMatches(highlighteds []string, after int) string {
+func (attr attrStruct) prettyMatches(matches matchOptions) string {
 	var valueText string
-	if len(highlighteds) == 0 {
+	after := matches.after
+	if matches.pattern == nil || attr.isEncrypted() || attr.isBinary() {
 		valueText = attr.title()
 	} else {
-		valueText = strings.TrimSpace(attr.getValue())
+		// only trailing space is trimmed, to keep the line numbers
+		valueText = strings.TrimRightFunc(attr.getValue(), unicode.IsSpace)
 
 		matchinglines := make([]string, 0, 0)
 
@@ -260,7 +242,7 @@ func (attr attrStruct) prettyMatches(highlighteds []string, after int) string {
 			line = strings.TrimSpace(line)
 			isCoveredByLastMatch := lastMatchingLine != -1 && linenumber <= lastMatchingLine+after
 
-			line, matched := highlightLine(line, highlighteds)
+			line, matched := highlightLine(line, matches.pattern)
 			if matched {
 				lastMatchingLine = linenumber
 				if true || !isCoveredByLastMatch {
@@ -268,9 +250,11 @@ func (attr attrStruct) prettyMatches(highlighteds []string, after int) string {
 				}
 			}
 			if matched || isCoveredByLastMatch {
-				//prefix := fmt.Sprintf("%s L%s:", strings.Repeat(" ", len(attr.getIdentifier())), strconv.Itoa(linenumber+1))
 				prefix := fmt.Sprintf("%s", strings.Repeat(" ", 3+len(attr.getIdentifier())))
-				matchinglines = append(matchinglines, color(prefix, "black")+line)
+				if matches.lineNumbers {
+					prefix += strconv.Itoa(linenumber+1) + ":"
+				}
+				matchinglines = append(matchinglines, color(prefix, themeColor("context"))+line)
 				if maxShownMatches != -1 && matchCounter >= maxShownMatches {
 					break
 				}
@@ -283,6 +267,9 @@ func (attr attrStruct) prettyMatches(highlighteds []string, after int) string {
 }
 
 func (attr attrStruct) title() string {
+	if attr.isEncrypted() {
+		return encryptedTitle
+	}
 	valueText := strings.TrimSpace(attr.getTextValue())
 	firstLineEndIndex := strings.Index(valueText, "\n")
 
@@ -298,126 +285,101 @@ func (attr attrStruct) title() string {
 
 func (attr attrStruct) prettyAt() string {
 	if attr.getUpdatedAt().IsZero() {
-		return attr.getCreatedAt().Local().Format(datelayout) // + " "
+		return attr.getCreatedAt().Local().Format(dateLayout()) // + " "
 	}
-	return attr.getUpdatedAt().Local().Format(datelayout) // + "*"
+	return attr.getUpdatedAt().Local().Format(dateLayout()) // + "*"
 }
 
 func (attr attrStruct) prettyCreatedAt() string {
-	return attr.getCreatedAt().Local().Format(datelayout)
+	return attr.getCreatedAt().Local().Format(dateLayout())
 }
 
 func (attr attrStruct) prettyUpdatedAt() string {
 	if !attr.getUpdatedAt().IsZero() {
-		return attr.getUpdatedAt().Local().Format(datelayout)
+		return attr.getUpdatedAt().Local().Format(dateLayout())
 	}
 	return ""
 }
 
+// filepath writes attr's value to a file listed by "ls -l", it expires
+// after listFileTTL.
 func (attr attrStruct) filepath() string {
-	// FIXME Temporary directory /tmp/ probably only works on Linux and macOS
-	// however, I'm using /tmp/ because on macOS the fsnotify is not able to
-	// watch the file when I leave this directory empty (Go chooses /var/tmp/)
-	f, err := ioutil.TempFile("/tmp/", "eton-edit")
-	check(err)
-	f.Close()
-	writeToFile(f.Name(), attr.getValue())
-	return f.Name()
+	return writeTempFile(fmt.Sprintf("%s%d-", listFilePrefix, attr.getID()), attr.getValue())
 }
 
 // setAlias sets attr's Alias to the given alias.
 // If give alias is empty string, it will unset the alias (set it to NULL in the database).
-func (attr attrStruct) setAlias(db *sql.DB, alias string) {
-
-	unset := len(alias) == 0
-	if !unset {
-		var validAlias = regexp.MustCompile(`[^\s\d]+`)
-		if !validAlias.MatchString(alias) {
-			fmt.Fprintln(out, "Alias must contain a non-numeric character")
-			return
-		}
+func (attr attrStruct) setAlias(ctx context.Context, store eton.Store, alias string) {
+	updated, err := store.SetAlias(ctx, attr.getID(), alias)
+	switch {
+	case errors.Is(err, eton.ErrInvalidAlias):
+		fmt.Fprintln(out, "Alias must contain a non-numeric character")
+		return
+	case errors.Is(err, eton.ErrAliasTaken):
+		log.Fatalf("error while setting alias \"%s\" for ID:%d -- alias must be unique\n", alias, attr.getID())
+	case err != nil:
+		log.Fatal(err)
 	}
 
-	stmt, err := db.Prepare("UPDATE attributes SET alias = ? WHERE id = ?")
-	check(err)
-
-	if !unset {
-		_, err = stmt.Exec(alias, attr.getID())
+	if len(alias) == 0 {
+		fmt.Fprintf(out, "ID:%d unaliased\n", attr.getID())
 	} else {
-		_, err = stmt.Exec(nil, attr.getID())
+		fmt.Fprintf(out, "alias set: %s => %s\n", attr.getIdentifier(), alias)
 	}
-	if err == nil {
-		if unset {
-			fmt.Fprintf(out, "ID:%d unaliased\n", attr.getID())
-		} else {
-			fmt.Fprintf(out, "alias set: %s => %s\n", attr.getIdentifier(), alias)
-		}
-	} else {
-		log.Fatalf("error while setting alias \"%s\" for ID:%d -- alias must be unique\n", alias, attr.getID()) // , err)
+	if updated > 0 {
+		fmt.Fprintf(out, "links updated in %d notes\n", updated)
 	}
 }
 
-func (attr attrStruct) setMark(db *sql.DB, mark int) (rowsAffected int64) {
-	stmt, err := db.Prepare("UPDATE attributes SET mark = ? WHERE id = ? AND deleted_at IS NULL")
-	check(err)
-
-	result, err := stmt.Exec(mark, attr.getID())
-	check(err)
-	rowsAffected, err = result.RowsAffected()
-	check(err)
-
-	return rowsAffected
-}
-
-func (attr attrStruct) rm(db *sql.DB) (rowsAffected int64) {
-	stmt, err := db.Prepare("UPDATE attributes SET deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL")
-	check(err)
-
-	result, err := stmt.Exec(attr.getID())
-	check(err)
-	rowsAffected, err = result.RowsAffected()
-	check(err)
-
-	return rowsAffected
-}
-
-func (attr attrStruct) unrm(db *sql.DB) (rowsAffected int64) {
-	stmt, err := db.Prepare("UPDATE attributes SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL")
-	check(err)
-
-	result, err := stmt.Exec(attr.getID())
-	check(err)
-	rowsAffected, err = result.RowsAffected()
-	check(err)
-
-	return rowsAffected
-}
-
-func (attr attrStruct) incrementFrequency(db *sql.DB) (rowsAffected int64) {
-	stmt, err := db.Prepare("UPDATE attributes SET frequency = frequency + 1 WHERE id = ? AND deleted_at IS NULL")
-	check(err)
-
-	result, err := stmt.Exec(attr.getID())
-	check(err)
+func (attr attrStruct) edit(ctx context.Context, store eton.Store, opts options) (rowsAffected int64) {
+	content := func(attr attrStruct) string {
+		return attr.getValue()
+	}
+	update := func(valueText string, version int64) (int64, error) {
+		return store.UpdateIfVersion(ctx, attr.getID(), valueText, version)
+	}
 
-	rowsAffected, err = result.RowsAffected()
-	check(err)
-	return
-}
+	if attr.isBinary() {
+		log.Fatalf("%s is a binary file, write it out with getfile to edit it", attr.getIdentifier())
+	}
+	if attr.isFile() {
+		// value_text holds the path of a file, its content is in value_blob
+		update = func(valueText string, version int64) (int64, error) {
+			return store.UpdateBlobIfVersion(ctx, attr.getID(), []byte(valueText), version)
+		}
+	}
 
-func (attr attrStruct) updateDb(db *sql.DB, valueText string) (rowsAffected int64) {
-	updateStmt, err := db.Prepare("UPDATE attributes SET value_text = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?")
-	check(err)
+	if attr.isEncrypted() {
+		secret := secretForNote(attr, opts)
+		content = func(attr attrStruct) string {
+			return attr.decrypt(secret)
+		}
+		update = func(valueText string, version int64) (int64, error) {
+			return store.UpdateBlobIfVersion(ctx, attr.getID(), encryptValue(valueText, secret), version)
+		}
+	}
 
-	result, err := updateStmt.Exec(valueText, attr.getID())
-	check(err)
-	rowsAffected, err = result.RowsAffected()
-	check(err)
-	return rowsAffected
-}
+	// base is the last saved content, and version its version. Saves are
+	// refused if the note was saved by someone else since.
+	base, version, conflicted := content(attr), attr.Version, false
+	save := func(valueText string) {
+		if conflicted || valueText == base {
+			return
+		}
+		newVersion, err := update(valueText, version)
+		if errors.Is(err, eton.ErrConflict) {
+			// merged when the editor exits
+			conflicted = true
+			return
+		}
+		check(err)
+		base, version = valueText, newVersion
+		rowsAffected = 1
+	}
 
-func (attr attrStruct) edit(db *sql.DB) (rowsAffected int64) {
-	filepath := attr.filepath()
+	filepath := writeTempFile(editFilePrefix, base)
+	trackTempFile(filepath)
+	defer removeTempFile(filepath)
 
 	watcher, err := fsnotify.NewWatcher()
 	check(err)
@@ -429,8 +391,7 @@ func (attr attrStruct) edit(db *sql.DB) (rowsAffected int64) {
 			case event := <-watcher.Events:
 				if event.Op&fsnotify.Create == fsnotify.Create || event.Op&fsnotify.Write == fsnotify.Write {
 					if event.Name == filepath {
-						valueText := readFile(filepath)
-						rowsAffected = attr.updateDb(db, valueText)
+						save(readFile(filepath))
 					}
 				}
 			case err := <-watcher.Errors:
@@ -445,40 +406,48 @@ func (attr attrStruct) edit(db *sql.DB) (rowsAffected int64) {
 	err = watcher.Add(filepath)
 	check(err)
 
-	defer func() {
-		done <- true
-	}()
+	saved := openEditor(filepath)
 
-	if openEditor(filepath) == false {
+	// stop saving in the background before the last save
+	done <- true
+	if !saved {
 		return rowsAffected
 	}
 
 	valueText := readFile(filepath)
+	save(valueText)
+
+	for conflicted {
+		// merge with the version saved meanwhile, both versions are kept
+		// between conflict markers if they changed the same lines
+		current := findAttributeByID(ctx, store, attr.getID())
+		if current.getID() == -1 {
+			log.Fatalf("%s was removed while you edited it, your version is in %s", attr.getIdentifier(), filepath)
+		}
+
+		merged, conflicts := merge3(base, valueText, content(current))
+		_, err := update(merged, current.Version)
+		if errors.Is(err, eton.ErrConflict) {
+			continue
+		}
+		check(err)
 
-	if valueText != attr.getValue() {
-		rowsAffected = attr.updateDb(db, valueText)
+		if conflicts > 0 {
+			fmt.Printf("%s was saved while you edited it, %d conflicts are marked in it, resolve them with: eton edit %s\n", attr.getIdentifier(), conflicts, attr.getIdentifier())
+		} else {
+			fmt.Printf("%s was saved while you edited it, the changes were merged\n", attr.getIdentifier())
+		}
+		conflicted = false
+		rowsAffected = 1
 	}
 	return rowsAffected
 }
 
-func writeToFile(filepath string, content string) {
-	err := ioutil.WriteFile(filepath, []byte(content), 0644)
-	check(err)
-}
-
-func highlightLine(line string, highlighteds []string) (string, bool) {
-	if len(highlighteds) == 0 {
+func highlightLine(line string, re *regexp.Regexp) (string, bool) {
+	if re == nil {
 		return line, false
 	}
-	reFlags := "(?i)"
-
-	quotedHighlighteds := make([]string, len(highlighteds), len(highlighteds))
-
-	for i, str := range highlighteds {
-		quotedHighlighteds[i] = regexp.QuoteMeta(str)
-	}
 
-	re := regexp.MustCompile(reFlags + "(" + strings.Join(quotedHighlighteds, "|") + ")")
 	if indexes := re.FindStringIndex(line); indexes != nil {
 		var indexBegin int
 		var indexEnd int
@@ -509,12 +478,25 @@ func highlightLine(line string, highlighteds []string) (string, bool) {
 			afterStr = ellipsis
 		}
 
-		line = re.ReplaceAllString(line[indexBegin:indexEnd], color("$0", "black+b:green"))
+		line = re.ReplaceAllString(line[indexBegin:indexEnd], color("$0", themeColor("match")))
 		return beforeStr + line + afterStr, true
 	}
 	return line, false
 }
 
+// countMatches returns the number of lines of attr matching re.
+func (attr attrStruct) countMatches(re *regexp.Regexp) (count int) {
+	if re == nil || attr.isEncrypted() || attr.isBinary() {
+		return 0
+	}
+	for _, line := range strings.Split(attr.getValue(), "\n") {
+		if re.MatchString(line) {
+			count++
+		}
+	}
+	return count
+}
+
 func prettyAttr(name, value string) string {
 	if len(name) > 0 {
 		name = name + ":"
@@ -544,238 +526,64 @@ func isOutputColored() bool {
 	return termutil.Isatty(os.Stdout.Fd())
 }
 
-func findAttributeByID(db *sql.DB, ID int64) (attr attrStruct) {
-	var err error
-	var stmt *sql.Stmt
-
-	defer func() {
-		if err == nil {
-			attr.incrementFrequency(db)
-		}
-	}()
-
-	stmt, err = db.Prepare("SELECT " + sqlSelect + " FROM attributes WHERE id = ? AND deleted_at IS NULL LIMIT 1")
+// updateNote replaces the content of a note.
+func updateNote(ctx context.Context, store eton.Store, id int64, valueText string) int64 {
+	rowsAffected, err := store.Update(ctx, id, valueText)
 	check(err)
-
-	err = stmt.QueryRow(ID).Scan(&attr.ID, &attr.ValueText, &attr.Name, &attr.ParentID, &attr.Alias, &attr.Mark, &attr.ValueBlob, &attr.CreatedAt, &attr.UpdatedAt)
-	if err != nil {
-		// log.Fatalln("No record found with id", ID, err)
-	}
-	return
+	return rowsAffected
 }
 
-func findAttributeByAlias(db *sql.DB, alias string, exactMatchOnly bool) (attr attrStruct) {
-	var err error
-	var stmt *sql.Stmt
-
-	defer func() {
-		if err == nil {
-			attr.incrementFrequency(db)
-		}
-	}()
-
-	// Exact match
-	stmt, err = db.Prepare("SELECT " + sqlSelect + "  FROM attributes WHERE alias = ? ORDER BY " + orderby + " LIMIT 1")
-	check(err)
-	err = stmt.QueryRow(alias).Scan(&attr.ID, &attr.ValueText, &attr.Name, &attr.ParentID, &attr.Alias, &attr.Mark, &attr.ValueBlob, &attr.CreatedAt, &attr.UpdatedAt)
-	if err == nil {
-		return attr
-	}
-
-	if exactMatchOnly {
-		return attr
-	}
-
-	stmt, err = db.Prepare("SELECT " + sqlSelect + " FROM attributes WHERE alias LIKE ? ORDER BY " + orderby + " LIMIT 1")
-	check(err)
-
-	// Prefix match
-	err = stmt.QueryRow(alias+"%").Scan(&attr.ID, &attr.ValueText, &attr.Name, &attr.ParentID, &attr.Alias, &attr.Mark, &attr.ValueBlob, &attr.CreatedAt, &attr.UpdatedAt)
-	if err == nil {
-		return attr
+// attrsFromStore wraps the attributes returned by the store.
+func attrsFromStore(attrs []eton.Attr) []attrStruct {
+	wrapped := make([]attrStruct, len(attrs))
+	for i := range attrs {
+		wrapped[i] = attrStruct{attrs[i]}
 	}
+	return wrapped
+}
 
-	// Postfix match
-	err = stmt.QueryRow("%"+alias).Scan(&attr.ID, &attr.ValueText, &attr.Name, &attr.ParentID, &attr.Alias, &attr.Mark, &attr.ValueBlob, &attr.CreatedAt, &attr.UpdatedAt)
-	if err == nil {
-		return attr
+// attrFromStore wraps an attribute returned by the store. Not found
+// attributes have an ID of -1, other errors are fatal.
+func attrFromStore(attr eton.Attr, err error) attrStruct {
+	if errors.Is(err, eton.ErrNotFound) {
+		return attrStruct{}
 	}
-
-	prunes := strings.Split(alias, "")
-
-	// Fuzzy match
-	err = stmt.QueryRow("%"+strings.Join(prunes, "%")+"%").Scan(&attr.ID, &attr.ValueText, &attr.Name, &attr.ParentID, &attr.Alias, &attr.Mark, &attr.ValueBlob, &attr.CreatedAt, &attr.UpdatedAt)
-	if err == nil {
-		return attr
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	return attr
+	return attrStruct{attr}
 }
 
-func findAttributeByAliasOrID(db *sql.DB, indentifier string) (attr attrStruct) {
-	attr = findAttributeByAlias(db, indentifier, false)
-	if attr.getID() <= 0 {
-
-		intID, err := strconv.Atoi(indentifier)
-
-		if err != nil {
-			return attr
-		}
-
-		attr = findAttributeByID(db, int64(intID))
-	}
-
-	return attr
+func findAttributeByID(ctx context.Context, store eton.Store, ID int64) attrStruct {
+	return attrFromStore(store.Get(ctx, ID))
 }
 
-func listWithFilters(db *sql.DB, opts options) (attrs []attrStruct) {
-	var stmt *sql.Stmt
-	var rows *sql.Rows
-	var nolimit = opts.Limit == -1
-
-	var sqlConditions string
-	var sqlLimit string
-
-	queryValues := make([]interface{}, 0, 5)
-
-	if opts.IncludeRemoved {
-		sqlConditions = "deleted_at IS NOT NULL"
-	} else {
-		sqlConditions = "deleted_at IS NULL"
-	}
-
-	if opts.RootID == -1 {
-		sqlConditions += " AND parent_id IS NULL"
-	} else {
-		nolimit = true
-		sqlConditions += fmt.Sprintf(" AND parent_id = %d ", opts.RootID)
-	}
-
-	if !opts.Recursive {
-		sqlConditions += " AND parent_id IS NULL"
-	}
-
-	if opts.ShortMode {
-		// sqlConditions += " AND ((alias IS NOT NULL AND alias != '') OR mark > 0)"
-		sqlConditions += " AND mark > 0"
-	}
-
-	if opts.RootID == -1 && len(opts.Filters) > 0 {
-		nolimit = true
-		nameOrVal := make([]string, 0, 0)
-
-		for _, filter := range opts.Filters {
-			likeValue := "%" + filter + "%"
-			// queryValues = append(queryValues, likeValue, likeValue, likeValue)
-			queryValues = append(queryValues, likeValue, likeValue)
-
-			// nameOrVal = append(nameOrVal, "(value_text LIKE ? OR name LIKE ? OR alias LIKE ?)")
-			nameOrVal = append(nameOrVal, "(value_text LIKE ? OR alias LIKE ?)")
-		}
-
-		sqlConditions += " AND ( " + strings.Join(nameOrVal, " AND ") + " )"
-	}
-
-	if nolimit {
-		sqlLimit = ""
-	} else {
-		queryValues = append(queryValues, opts.Offset)
-		queryValues = append(queryValues, opts.Limit)
-		sqlLimit = "LIMIT ?, ?"
-	}
-
-	tx, err := db.Begin()
-	check(err)
-	stmt, err = tx.Prepare("SELECT " + sqlSelect + " FROM attributes WHERE " + sqlConditions + " ORDER BY " + orderby + " " + sqlLimit)
-	check(err)
-	defer stmt.Close()
-	rows, err = stmt.Query(queryValues...)
-	check(err)
-	defer rows.Close()
-
-	attrs = make([]attrStruct, 0, 0)
+func findAttributeByAlias(ctx context.Context, store eton.Store, alias string, exactMatchOnly bool) attrStruct {
+	attr, err := store.FindByAlias(ctx, alias, exactMatchOnly)
+	return attrFromStore(resolveAmbiguity(ctx, store, attr, err))
+}
 
-	for rows.Next() {
-		attr := attrStruct{}
-		err = rows.Scan(&attr.ID, &attr.ValueText, &attr.Name, &attr.ParentID, &attr.Alias, &attr.Mark, &attr.ValueBlob, &attr.CreatedAt, &attr.UpdatedAt)
-		check(err)
-		attrs = append(attrs, attr)
+func findAttributeByAliasOrID(ctx context.Context, store eton.Store, indentifier string) attrStruct {
+	attr, err := store.Find(ctx, indentifier)
+	return attrFromStore(resolveAmbiguity(ctx, store, attr, err))
+}
 
-		var optsNew options
-		optsNew = opts
-		optsNew.RootID = attr.getID()
-		optsNew.Indent += 2
+func listWithFilters(ctx context.Context, store eton.Store, opts options) []attrStruct {
+	attrs, err := listNotes(ctx, store, opts)
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	tx.Commit()
 	return attrs
 }
 
-func getLastAttrID(db *sql.DB) int64 {
-	// Experimental
-	var ID int64
-
-	stmt, err := db.Prepare("SELECT id FROM attributes WHERE deleted_at IS NULL ORDER BY " + orderby + " LIMIT 1")
-	check(err)
-
-	err = stmt.QueryRow().Scan(&ID)
-	check(err)
-	return ID
+// listNotes is listWithFilters for callers that handle invalid queries,
+// e.g. browse while the query is being typed.
+func listNotes(ctx context.Context, store eton.Store, opts options) ([]attrStruct, error) {
+	attrs, err := store.List(ctx, opts.listOptions())
+	return attrsFromStore(attrs), err
 }
 
-func saveString(db *sql.DB, valueText string) (lastInsertID int64) {
-	stmt, err := db.Prepare("INSERT INTO attributes (name, value_text) VALUES ('note', ?)")
-	check(err)
-
-	result, err := stmt.Exec(valueText)
-	check(err)
-
-	lastInsertID, err = result.LastInsertId()
-	check(err)
-
-	return lastInsertID
-}
-
-func initializeDatabase(db *sql.DB) bool {
-	// TODO use fts3 for faster full-text search: CREATE VIRTUAL TABLE attributes USING fts3 (...)
-	sqlStmt := `
-  DROP TABLE IF EXISTS attributes;
-	CREATE TABLE attributes (
-		id          INTEGER NOT NULL PRIMARY KEY,
-		name        TEXT,
-		alias       TEXT,
-		parent_id   INTEGER,
-		frequency   INTEGER DEFAULT 0,
-		mark        INTEGER DEFAULT 0,
-
-		value_text  TEXT,
-		value_blob  BLOB,
-		value_int   INTEGER,
-		value_real  REAL,
-		value_time  DATETIME,
-
-		accessed_at DATETIME,
-		updated_at  DATETIME,
-		deleted_at  DATETIME,
-		created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);
-
-  CREATE UNIQUE INDEX IF NOT EXISTS index_on_alias        ON attributes (alias);
-  CREATE        INDEX IF NOT EXISTS index_on_name         ON attributes (name);
-  CREATE        INDEX IF NOT EXISTS index_on_value_text   ON attributes (value_text);
-  CREATE        INDEX IF NOT EXISTS index_on_value_blob   ON attributes (value_blob);
-  CREATE        INDEX IF NOT EXISTS index_on_value_int    ON attributes (value_int);
-  CREATE        INDEX IF NOT EXISTS index_on_value_real   ON attributes (value_real);
-  CREATE        INDEX IF NOT EXISTS index_on_accessed_at  ON attributes (accessed_at);
-  CREATE        INDEX IF NOT EXISTS index_on_deleted_at   ON attributes (deleted_at);
-  CREATE        INDEX IF NOT EXISTS index_on_frequency    ON attributes (frequency);
-  CREATE        INDEX IF NOT EXISTS index_on_mark         ON attributes (mark);
-	`
-	_, err := db.Exec(sqlStmt)
-	if err != nil {
-		log.Fatal(err)
-		return false
-	}
-	fmt.Fprintln(out, "repository initiated")
-	return true
+func getLastAttrID(ctx context.Context, store eton.Store) int64 {
+	// Experimental
+	return attrFromStore(store.Last(ctx)).getID()
 }
@@ -0,0 +1,630 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/andrew-d/go-termutil"
+	"github.com/siadat/eton/eton"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// browse modes, keys typed in browseSearch edit the query
+const (
+	browseNormal = iota
+	browseSearch
+	browsePrompt
+)
+
+const browseHelp = "enter edit  m mark  a alias  d rm  u unrm  R removed  / search  n/p page  q quit"
+
+// browser is the state of "eton browse": a page of the notes matching the
+// query, and a preview of the selected one.
+type browser struct {
+	ctx   context.Context
+	store eton.Store
+	opts  options
+
+	query    []rune
+	mode     int
+	prompt   string
+	input    []rune
+	onSubmit func(input string)
+	message  string
+
+	attrs            []attrStruct // the page, Limit is pageSize
+	page             int
+	selected         int
+	more             bool  // there are pages after this one
+	removed          int64 // last removed note, recovered with "u"
+	removedRecursive bool  // removed with the notes under it
+
+	width, height int
+	keys          *bufio.Reader
+	w             *bufio.Writer
+	state         *terminal.State
+}
+
+func cmdBrowse(ctx context.Context, store eton.Store, opts options) bool {
+	if !termutil.Isatty(os.Stdin.Fd()) || !isOutputColored() {
+		log.Fatal("browse needs a terminal")
+	}
+
+	b := &browser{
+		ctx:   ctx,
+		store: store,
+		opts:  opts,
+		query: []rune(strings.Join(opts.Filters, " ")),
+		keys:  bufio.NewReader(os.Stdin),
+		w:     bufio.NewWriter(out),
+	}
+	if len(b.query) == 0 {
+		b.mode = browseSearch
+	}
+
+	b.start()
+	// the terminal is restored on panics too
+	defer b.stop()
+
+	b.resize()
+	b.load()
+	for {
+		b.render()
+		key, err := readKey(b.keys)
+		if err == io.EOF {
+			return true
+		}
+		check(err)
+		b.resize()
+		if !b.handle(key) {
+			return true
+		}
+	}
+}
+
+// start puts the terminal in raw mode and switches to the alternate screen,
+// without line wrapping.
+func (b *browser) start() {
+	state, err := terminal.MakeRaw(int(os.Stdin.Fd()))
+	check(err)
+	b.state = state
+	fmt.Fprint(b.w, "\x1b[?1049h\x1b[?7l\x1b[?25l")
+	b.w.Flush()
+}
+
+func (b *browser) stop() {
+	if b.state == nil {
+		return
+	}
+	fmt.Fprint(b.w, "\x1b[?25h\x1b[?7h\x1b[?1049l")
+	b.w.Flush()
+	terminal.Restore(int(os.Stdin.Fd()), b.state)
+	b.state = nil
+}
+
+// resize reads the size of the terminal, and reloads the page if the
+// number of listed notes changes, keeping the selected note.
+func (b *browser) resize() {
+	oldPageSize := b.pageSize()
+	width, height, err := terminal.GetSize(int(os.Stdin.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	b.width, b.height = width, height
+
+	if oldPageSize != b.pageSize() && b.attrs != nil {
+		position := b.page*oldPageSize + b.selected
+		b.page, b.selected = position/b.pageSize(), position%b.pageSize()
+		b.load()
+	}
+}
+
+// pageSize is the number of listed notes, about half of the screen. The
+// other half is the preview, between the query and the status lines.
+func (b *browser) pageSize() int {
+	size := (b.height - 3) / 2
+	if size < 3 {
+		size = 3
+	}
+	return size
+}
+
+// load lists the notes of the current page. A query that does not parse,
+// e.g. while a phrase is being typed, keeps the previous page.
+func (b *browser) load() {
+	opts := b.opts
+	opts.Filters = strings.Fields(string(b.query))
+	opts.Paged = true
+	opts.Offset = b.page * b.pageSize()
+	// one more to know if there is a next page
+	opts.Limit = b.pageSize() + 1
+
+	attrs, err := listNotes(b.ctx, b.store, opts)
+	var queryErr *eton.QueryError
+	if errors.As(err, &queryErr) {
+		b.message = "query: " + queryErr.Msg
+		return
+	}
+	check(err)
+
+	b.more = len(attrs) > b.pageSize()
+	if b.more {
+		attrs = attrs[:b.pageSize()]
+	}
+	if len(attrs) == 0 && b.page > 0 {
+		// the last note of the last page was removed
+		b.page--
+		b.load()
+		return
+	}
+	b.attrs = attrs
+	if b.selected >= len(b.attrs) {
+		b.selected = len(b.attrs) - 1
+	}
+	if b.selected < 0 {
+		b.selected = 0
+	}
+}
+
+func (b *browser) current() (attrStruct, bool) {
+	if b.selected < len(b.attrs) {
+		return b.attrs[b.selected], true
+	}
+	b.message = "no notes"
+	return attrStruct{}, false
+}
+
+func (b *browser) render() {
+	fmt.Fprint(b.w, "\x1b[H")
+	line := func(text string) {
+		fmt.Fprint(b.w, text, "\x1b[K\r\n")
+	}
+
+	header := fmt.Sprintf("page %d", b.page+1)
+	if b.opts.IncludeRemoved {
+		header += ", removed notes"
+	}
+	line(fmt.Sprintf("/%s  %s", string(b.query), color(header, themeColor("context"))))
+
+	for i := 0; i < b.pageSize(); i++ {
+		if i >= len(b.attrs) {
+			line("")
+			continue
+		}
+		attr := b.attrs[i]
+		identifier := color(attr.getIdentifier(), themeColor("id"))
+		if attr.getMark() > 0 {
+			identifier = color(attr.getIdentifier(), themeColor("marked"))
+		}
+		text := fmt.Sprintf("%s%s: %s%s", identifier, attr.prettyTags(), attr.title(), attr.prettyFileInfo())
+		if i == b.selected {
+			line("> " + text)
+		} else {
+			line("  " + text)
+		}
+	}
+
+	line(color(strings.Repeat("─", b.width), themeColor("context")))
+	preview := b.preview()
+	for i := 0; i < b.height-b.pageSize()-3; i++ {
+		if i < len(preview) {
+			line(preview[i])
+		} else {
+			line("")
+		}
+	}
+
+	status := browseHelp
+	if b.mode == browsePrompt {
+		status = b.prompt + string(b.input)
+	} else if len(b.message) > 0 {
+		status = b.message
+	}
+	fmt.Fprint(b.w, status, "\x1b[K")
+
+	switch b.mode {
+	case browseSearch:
+		fmt.Fprintf(b.w, "\x1b[1;%dH\x1b[?25h", 2+len(b.query))
+	case browsePrompt:
+		fmt.Fprintf(b.w, "\x1b[%d;%dH\x1b[?25h", b.height, 1+len([]rune(b.prompt))+len(b.input))
+	default:
+		fmt.Fprint(b.w, "\x1b[?25l")
+	}
+	b.w.Flush()
+}
+
+// preview returns the lines of the selected note, only the ones matching
+// the query if there is one, as printed by grep.
+func (b *browser) preview() []string {
+	if b.selected >= len(b.attrs) {
+		return nil
+	}
+	attr := b.attrs[b.selected]
+
+	dates := "created " + attr.prettyCreatedAt()
+	if updated := attr.prettyUpdatedAt(); len(updated) > 0 {
+		dates += ", updated " + updated
+	}
+	lines := []string{color(dates, themeColor("context"))}
+
+	opts := b.opts
+	opts.Filters = strings.Fields(string(b.query))
+	matches := matchOptions{pattern: highlightPattern(opts), after: 2, lineNumbers: true}
+
+	text := attr.title()
+	if matches.pattern != nil {
+		text = attr.prettyMatches(matches)
+	} else if !attr.isEncrypted() && !attr.isBinary() {
+		text = attr.getValue()
+	}
+	for _, l := range strings.Split(strings.TrimRightFunc(text, unicode.IsSpace), "\n") {
+		lines = append(lines, strings.Replace(l, "\t", "    ", -1))
+	}
+	return lines
+}
+
+// handle runs the command of key, it returns false to quit.
+func (b *browser) handle(key string) bool {
+	b.message = ""
+	if key == "ctrl-c" {
+		return false
+	}
+
+	switch key {
+	case "up":
+		b.move(-1)
+		return true
+	case "down":
+		b.move(1)
+		return true
+	case "pgup":
+		b.turnPage(-1)
+		return true
+	case "pgdn":
+		b.turnPage(1)
+		return true
+	}
+
+	switch b.mode {
+	case browseSearch:
+		b.handleSearch(key)
+	case browsePrompt:
+		b.handlePrompt(key)
+	default:
+		return b.handleNormal(key)
+	}
+	return true
+}
+
+func (b *browser) handleSearch(key string) {
+	switch key {
+	case "enter":
+		b.edit()
+	case "esc", "tab":
+		b.mode = browseNormal
+	default:
+		if !editInput(&b.query, key) {
+			return
+		}
+		b.page, b.selected = 0, 0
+		b.load()
+	}
+}
+
+func (b *browser) handlePrompt(key string) {
+	switch key {
+	case "enter":
+		b.mode = browseNormal
+		b.onSubmit(string(b.input))
+	case "esc":
+		b.mode = browseNormal
+	default:
+		editInput(&b.input, key)
+	}
+}
+
+func (b *browser) handleNormal(key string) bool {
+	switch key {
+	case "q":
+		return false
+	case "/":
+		b.mode = browseSearch
+	case "esc":
+		if len(b.query) > 0 {
+			b.query = nil
+			b.page, b.selected = 0, 0
+			b.load()
+		}
+	case "j":
+		b.move(1)
+	case "k":
+		b.move(-1)
+	case "n":
+		b.turnPage(1)
+	case "p":
+		b.turnPage(-1)
+	case "enter", "e":
+		b.edit()
+	case "m":
+		b.toggleMark()
+	case "a":
+		b.askAlias()
+	case "d":
+		b.rm(false)
+	case "D":
+		b.rm(true)
+	case "u":
+		b.unrm()
+	case "R":
+		b.opts.IncludeRemoved = !b.opts.IncludeRemoved
+		b.page, b.selected = 0, 0
+		b.load()
+	default:
+		b.message = browseHelp
+	}
+	return true
+}
+
+// editInput applies an editing key to input, it returns false if key is
+// not one.
+func editInput(input *[]rune, key string) bool {
+	switch {
+	case key == "backspace":
+		if len(*input) > 0 {
+			*input = (*input)[:len(*input)-1]
+		}
+	case key == "ctrl-u":
+		*input = nil
+	case key == "ctrl-w":
+		text := strings.TrimRightFunc(string(*input), unicode.IsSpace)
+		*input = []rune(text[:strings.LastIndexFunc(text, unicode.IsSpace)+1])
+	case len([]rune(key)) == 1:
+		*input = append(*input, []rune(key)...)
+	default:
+		return false
+	}
+	return true
+}
+
+// move moves the selection, to the next or the previous page past the
+// ends of this one.
+func (b *browser) move(delta int) {
+	selected := b.selected + delta
+	switch {
+	case selected < 0 && b.page > 0:
+		b.page--
+		b.selected = b.pageSize() - 1
+		b.load()
+	case selected >= len(b.attrs) && b.more:
+		b.page++
+		b.selected = 0
+		b.load()
+	case selected >= 0 && selected < len(b.attrs):
+		b.selected = selected
+	}
+}
+
+func (b *browser) turnPage(delta int) {
+	if delta > 0 && !b.more || delta < 0 && b.page == 0 {
+		return
+	}
+	b.page += delta
+	b.selected = 0
+	b.load()
+}
+
+// edit opens the selected note in the editor, with the terminal restored.
+func (b *browser) edit() {
+	attr, ok := b.current()
+	if !ok {
+		return
+	}
+	if b.opts.IncludeRemoved {
+		b.message = "press u to recover " + attr.getIdentifier() + " before editing it"
+		return
+	}
+	b.stop()
+	// reloaded, the list does not have the latest version
+	attr = findAttributeByID(b.ctx, b.store, attr.getID())
+	updated := int64(0)
+	if attr.getID() != -1 {
+		updated = attr.edit(b.ctx, b.store, b.opts)
+	}
+	b.start()
+
+	if updated > 0 {
+		b.message = attr.getIdentifier() + " saved"
+	}
+	b.load()
+}
+
+func (b *browser) toggleMark() {
+	attr, ok := b.current()
+	if !ok {
+		return
+	}
+	mark := 1
+	if attr.getMark() > 0 {
+		mark = 0
+	}
+	setMark(b.ctx, b.store, attr, mark)
+	if mark > 0 {
+		b.message = attr.getIdentifier() + " marked"
+	} else {
+		b.message = attr.getIdentifier() + " unmarked"
+	}
+	b.load()
+}
+
+// askAlias prompts for the alias of the selected note, an empty alias
+// unaliases it.
+func (b *browser) askAlias() {
+	attr, ok := b.current()
+	if !ok {
+		return
+	}
+	b.mode = browsePrompt
+	b.prompt = "alias of " + attr.getIDString() + ": "
+	b.input = []rune(attr.getAlias())
+	b.onSubmit = func(alias string) {
+		alias = strings.TrimSpace(alias)
+		updated, err := b.store.SetAlias(b.ctx, attr.getID(), alias)
+		switch {
+		case errors.Is(err, eton.ErrInvalidAlias):
+			b.message = "alias must contain a non-numeric character"
+			return
+		case errors.Is(err, eton.ErrAliasTaken):
+			b.message = fmt.Sprintf("alias %q is taken", alias)
+			return
+		}
+		check(err)
+
+		if len(alias) == 0 {
+			b.message = fmt.Sprintf("ID:%d unaliased", attr.getID())
+		} else {
+			b.message = fmt.Sprintf("alias set: %d => %s", attr.getID(), alias)
+		}
+		if updated > 0 {
+			b.message += fmt.Sprintf(", links updated in %d notes", updated)
+		}
+		b.load()
+	}
+}
+
+func (b *browser) rm(recursive bool) {
+	attr, ok := b.current()
+	if !ok {
+		return
+	}
+	if b.opts.IncludeRemoved {
+		b.message = attr.getIdentifier() + " is removed already"
+		return
+	}
+
+	_, err := b.store.Remove(b.ctx, attr.getID(), recursive)
+	if errors.Is(err, eton.ErrHasChildren) {
+		count, err := b.store.CountChildren(b.ctx, attr.getID())
+		check(err)
+		them := "them"
+		if count == 1 {
+			them = "it"
+		}
+		b.message = fmt.Sprintf("%s has %s under it, press D to remove %s too", attr.getIdentifier(), pluralNotes(count), them)
+		return
+	}
+	check(err)
+
+	b.removed, b.removedRecursive = attr.getID(), recursive
+	b.message = attr.getIdentifier() + " removed, press u to recover it"
+	b.load()
+}
+
+// unrm recovers the selected note in the list of removed notes, or else
+// the last note removed.
+func (b *browser) unrm() {
+	id, recursive := b.removed, b.removedRecursive
+	if b.opts.IncludeRemoved {
+		attr, ok := b.current()
+		if !ok {
+			return
+		}
+		id, recursive = attr.getID(), false
+	}
+	if id == 0 {
+		b.message = "nothing to recover, press R to list the removed notes"
+		return
+	}
+
+	_, err := b.store.Unremove(b.ctx, id, recursive)
+	if errors.Is(err, eton.ErrNotFound) {
+		b.message = fmt.Sprintf("ID:%d was purged", id)
+		b.removed = 0
+		return
+	}
+	check(err)
+	if id == b.removed {
+		b.removed = 0
+	}
+	b.message = fmt.Sprintf("ID:%d recovered", id)
+	b.load()
+}
+
+// readKey reads a key press in raw mode: a character, or the name of a
+// special key such as "up", "enter" or "ctrl-u".
+func readKey(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	switch c {
+	case '\r', '\n':
+		return "enter", nil
+	case '\t':
+		return "tab", nil
+	case 127, 8:
+		return "backspace", nil
+	case 2:
+		return "pgup", nil
+	case 6:
+		return "pgdn", nil
+	case 14:
+		return "down", nil
+	case 16:
+		return "up", nil
+	case 3:
+		return "ctrl-c", nil
+	case 21:
+		return "ctrl-u", nil
+	case 23:
+		return "ctrl-w", nil
+	case 27:
+		// a lone escape, unless a sequence was read with it
+		if r.Buffered() == 0 {
+			return "esc", nil
+		}
+		return readEscapeSequence(r)
+	}
+
+	if c < ' ' {
+		return fmt.Sprintf("ctrl-%c", c+'a'-1), nil
+	}
+	check(r.UnreadByte())
+	ch, _, err := r.ReadRune()
+	return string(ch), err
+}
+
+var escapeSequences = map[string]string{
+	"[A": "up", "OA": "up",
+	"[B": "down", "OB": "down",
+	"[C": "right", "OC": "right",
+	"[D": "left", "OD": "left",
+	"[5~": "pgup",
+	"[6~": "pgdn",
+}
+
+func readEscapeSequence(r *bufio.Reader) (string, error) {
+	var sequence []byte
+	for r.Buffered() > 0 {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		sequence = append(sequence, c)
+		// a sequence ends with a letter or ~, after its first byte
+		if len(sequence) > 1 && (c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '~') {
+			break
+		}
+	}
+	if key, ok := escapeSequences[string(sequence)]; ok {
+		return key, nil
+	}
+	return "esc", nil
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,117 +13,174 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/andrew-d/go-termutil"
+	"github.com/siadat/eton/eton"
 )
 
-// const orderby = "-frequency, -mark, CASE WHEN updated_at IS NULL THEN created_at ELSE updated_at END DESC"
-const (
-	orderby       = "CASE WHEN updated_at IS NULL THEN created_at ELSE updated_at END DESC"
-	defaultEditor = "vi"
-)
+const defaultEditor = "vi"
 
-func cmdShow(db *sql.DB, opts options) bool {
+func cmdShow(ctx context.Context, store eton.Store, opts options) bool {
 	if len(opts.IDs) == 0 && len(opts.Aliases) == 0 {
-		opts.IDs = append(opts.IDs, int64(getLastAttrID(db)))
+		opts.IDs = append(opts.IDs, int64(getLastAttrID(ctx, store)))
 	}
 
-	for _, id := range opts.IDs {
-		attr := findAttributeByID(db, id)
-		printToLess(attr.getValue())
+	attrs := findAttributesFromOpts(ctx, store, opts)
+	if opts.JSON || opts.JSONLines {
+		printJSON(os.Stdout, attrs, opts.JSONLines)
+		return true
 	}
 
-	for _, alias := range opts.Aliases {
-		attr := findAttributeByAlias(db, alias, false)
-		printToLess(attr.getValue())
+	for _, attr := range attrs {
+		if attr.isBinary() {
+			log.Fatalf("%s is a binary file (%s), use eton getfile %s", attr.getIdentifier(), attr.mimeType(), attr.getIdentifier())
+		}
+	}
+	for _, attr := range attrs {
+		printToLess(attr.decryptedValue(opts))
 	}
 	return true
 }
 
-func cmdCat(db *sql.DB, opts options) bool {
+func cmdCat(ctx context.Context, store eton.Store, opts options) bool {
 	if len(opts.IDs) == 0 && len(opts.Aliases) == 0 {
-		opts.IDs = append(opts.IDs, int64(getLastAttrID(db)))
+		opts.IDs = append(opts.IDs, int64(getLastAttrID(ctx, store)))
 	}
 
-	for _, id := range opts.IDs {
-		attr := findAttributeByID(db, id)
-		fmt.Printf(attr.getValue())
+	attrs := findAttributesFromOpts(ctx, store, opts)
+	if opts.JSON || opts.JSONLines {
+		printJSON(os.Stdout, attrs, opts.JSONLines)
+		return true
 	}
 
-	for _, alias := range opts.Aliases {
-		attr := findAttributeByAlias(db, alias, false)
-		fmt.Printf(attr.getValue())
+	// binary files are written to pipes only, they would garble a terminal
+	if termutil.Isatty(os.Stdout.Fd()) {
+		for _, attr := range attrs {
+			if attr.isBinary() {
+				log.Fatalf("%s is a binary file (%s), pipe it or use eton getfile %s", attr.getIdentifier(), attr.mimeType(), attr.getIdentifier())
+			}
+		}
+	}
+	for _, attr := range attrs {
+		_, err := os.Stdout.Write(attr.content(opts))
+		check(err)
 	}
 	return true
 }
 
-func cmdMount(db *sql.DB, opts options) bool {
-	log.Println("Not implemented yet")
-	/*
-		globalDB = db
-		globalOpts = opts
-		globalOpts.Offset = 0
-		globalOpts.Limit = 40
-		Mount(opts.MountPoint)
-	*/
-	return true
-}
-
-func cmdAddFiles(db *sql.DB, files []string) bool {
-	tx, err := db.Begin()
-
-	stmt, err := tx.Prepare("INSERT INTO attributes (name, value_text, value_blob) VALUES (?, ?, ?)")
-
-	if err != nil {
-		log.Fatal(err)
+func cmdMount(ctx context.Context, store eton.Store, opts options) bool {
+	if opts.Verbose {
+		log.Println("mounting at", opts.MountPoint)
 	}
-
-	defer stmt.Close()
-	if err != nil {
+	if err := mount(ctx, store, opts); err != nil {
 		log.Fatal(err)
 	}
+	return true
+}
 
+func cmdAddFiles(ctx context.Context, store eton.Store, files []string) bool {
 	for _, file := range files {
 		content, err := ioutil.ReadFile(file)
 		if err != nil {
 			log.Fatal(err)
 		}
 
+		info, err := os.Stat(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		fileAbsPath, err := filepath.Abs(file)
 
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		_, err = stmt.Exec("file", fileAbsPath, content)
+		_, err = store.AddFile(ctx, fileAbsPath, content, info.Mode(), info.ModTime())
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
+	return true
+}
+
+func cmdServe(store eton.Store, opts options) bool {
+	if err := serve(store, opts); err != nil {
+		log.Fatal(err)
+	}
+	return true
+}
+
+func cmdExport(ctx context.Context, store eton.Store, opts options) bool {
+	if opts.Format != "md" {
+		log.Fatalf("unsupported export format \"%s\"", opts.Format)
+	}
+
+	count, err := exportMarkdown(ctx, store, opts.Dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.Verbose {
+		fmt.Println(count, "exported")
+	}
+	return true
+}
+
+func cmdImport(ctx context.Context, store eton.Store, w *tabwriter.Writer, opts options) bool {
+	items, err := planImport(ctx, store, opts.Dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	counts := make(map[string]int)
+	for _, item := range items {
+		if !opts.DryRun {
+			item.apply(ctx, store)
+		}
+		if opts.DryRun || opts.Verbose {
+			fmt.Fprintln(w, item.describe())
+		}
+		counts[item.Action]++
+	}
+	w.Flush()
 
-	tx.Commit()
+	if opts.DryRun {
+		fmt.Printf("would create %d, update %d, skip %d\n", counts[importCreate], counts[importUpdate], counts[importSkip])
+	} else {
+		fmt.Printf("%d created, %d updated, %d skipped\n", counts[importCreate], counts[importUpdate], counts[importSkip])
+	}
 	return true
 }
 
-func cmdLs(db *sql.DB, w *tabwriter.Writer, opts options) bool {
-	attrs := listWithFilters(db, opts)
+func cmdLs(ctx context.Context, store eton.Store, w *tabwriter.Writer, opts options) bool {
+	attrs := listWithFilters(ctx, store, opts)
+	if opts.JSON || opts.JSONLines {
+		printJSON(os.Stdout, attrs, opts.JSONLines)
+		return true
+	}
+
+	matches := opts.matchOptions()
 	for _, attr := range attrs {
-		if opts.ListFilepaths {
+		if opts.Count {
+			fmt.Fprintf(out, "%s: %d\n", color(attr.getIdentifier(), themeColor("id")), attr.countMatches(matches.pattern))
+		} else if opts.ListFilepaths {
 			fmt.Println(attr.filepath())
 		} else if opts.ListIDs {
 			val, err := attr.ID.Value()
 			check(err)
 			fmt.Printf("%d\n", val)
 		} else {
-			attr.print(w, opts.Recursive, opts.Indent, opts.Filters, opts.AfterLinesCount)
+			attr.print(w, opts.Recursive, 2*attr.Depth, matches)
 		}
 	}
 	return true
 }
 
-func cmdNew(db *sql.DB, opts options) bool {
+func cmdNew(ctx context.Context, store eton.Store, opts options) bool {
 	var valueText string
 
 	if opts.FromStdin {
@@ -152,22 +211,38 @@ func cmdNew(db *sql.DB, opts options) bool {
 	} else if len(opts.Note) > 0 {
 		valueText = opts.Note
 	} else {
-		f, err := ioutil.TempFile("", "eton-edit")
-		check(err)
-		f.Close()
+		path := writeTempFile(editFilePrefix, "")
+		trackTempFile(path)
+		defer removeTempFile(path)
 
-		if openEditor(f.Name()) == false {
+		if openEditor(path) == false {
 			return false
 		}
 
-		valueText = readFile(f.Name())
+		valueText = readFile(path)
 
 		if len(valueText) == 0 {
 			return false
 		}
 	}
 
-	lastInsertID := saveString(db, valueText)
+	var parentID int64 = -1
+	if len(opts.Parent) > 0 {
+		parentID = findParent(ctx, store, opts.Parent).getID()
+	}
+
+	var lastInsertID int64
+	var err error
+	if opts.Encrypt {
+		lastInsertID, err = store.Insert(ctx, eton.Attr{
+			Name:      sql.NullString{String: "note", Valid: true},
+			ParentID:  sql.NullInt64{Int64: parentID, Valid: parentID != -1},
+			ValueBlob: encryptValue(valueText, readSecret(opts, true)),
+		})
+	} else {
+		lastInsertID, err = store.CreateNote(ctx, valueText, parentID)
+	}
+	check(err)
 	if lastInsertID > 0 && opts.Verbose {
 		fmt.Printf("New note ID:%d\n", lastInsertID)
 	}
@@ -175,32 +250,37 @@ func cmdNew(db *sql.DB, opts options) bool {
 	return true
 }
 
-func cmdAdd(db *sql.DB, id int, attrs []string) bool {
-	// TODO
-	return false
-}
-
-func cmdAddAttr(db *sql.DB, id int, attrs []string) bool {
-	var stmt *sql.Stmt
-
-	tx, err := db.Begin()
-
-	if id == -1 {
-		stmt, err = tx.Prepare("INSERT INTO attributes (name, value_text) VALUES (?, ?)")
-	} else {
-		stmt, err = tx.Prepare("INSERT INTO attributes (name, value_text, parent_id) VALUES (?, ?, ?)")
+func cmdEncrypt(ctx context.Context, store eton.Store, opts options) bool {
+	attr := findAttributeFromOpts(ctx, store, opts)
+	if attr.isEncrypted() {
+		fmt.Printf("%s is already encrypted\n", attr.getIdentifier())
+		return true
 	}
-
-	if err != nil {
-		log.Fatal(err)
+	if attr.ValueBlob != nil {
+		log.Fatalf("%s is a file, only notes can be encrypted", attr.getIdentifier())
 	}
 
-	defer stmt.Close()
+	ciphertext := encryptValue(attr.getTextValue(), readSecret(opts, true))
+	_, err := store.SetEncrypted(ctx, attr.getID(), ciphertext)
+	check(err)
+	fmt.Printf("%s encrypted\n", attr.getIdentifier())
+	return true
+}
 
-	if err != nil {
-		log.Fatal(err)
+func cmdGcTmp(opts options) bool {
+	removed := gcTempFiles(true)
+	if removed > 0 || opts.Verbose {
+		fmt.Println(removed, "temporary files removed")
 	}
+	return true
+}
 
+func cmdAdd(ctx context.Context, store eton.Store, id int, attrs []string) bool {
+	// TODO
+	return false
+}
+
+func cmdAddAttr(ctx context.Context, store eton.Store, id int, attrs []string) bool {
 	for _, attr := range attrs {
 		name := ""
 		value := ""
@@ -215,32 +295,30 @@ func cmdAddAttr(db *sql.DB, id int, attrs []string) bool {
 			value = nameValuePair[1]
 		}
 
-		if id == -1 {
-			_, err = stmt.Exec(name, value)
-		} else {
-			_, err = stmt.Exec(name, value, id)
-		}
+		_, err := store.Insert(ctx, eton.Attr{
+			Name:      sql.NullString{String: name, Valid: true},
+			ValueText: sql.NullString{String: value, Valid: true},
+			ParentID:  sql.NullInt64{Int64: int64(id), Valid: id != -1},
+		})
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
 
-	tx.Commit()
-
 	return true
 }
 
-func cmdUnalias(db *sql.DB, opts options) bool {
-	attr := findAttributeByAlias(db, opts.Alias, true)
+func cmdUnalias(ctx context.Context, store eton.Store, opts options) bool {
+	attr := findAttributeByAlias(ctx, store, opts.Alias, true)
 	if attr.getID() == -1 {
 		log.Fatalf("alias \"%s\" not found", opts.Alias)
 	} else {
-		attr.setAlias(db, "")
+		attr.setAlias(ctx, store, "")
 	}
 	return true
 }
 
-func cmdAlias(db *sql.DB, opts options) bool {
+func cmdAlias(ctx context.Context, store eton.Store, opts options) bool {
 	if !(opts.ID > 0 && len(opts.Alias1) > 0 || len(opts.Alias2) > 0) && !(len(opts.Alias1) > 0 && len(opts.Alias2) > 0) {
 		return false
 	}
@@ -248,20 +326,20 @@ func cmdAlias(db *sql.DB, opts options) bool {
 	var attr attrStruct
 
 	if opts.ID > 0 {
-		attr = findAttributeByID(db, opts.ID)
+		attr = findAttributeByID(ctx, store, opts.ID)
 		if len(opts.Alias1) > 0 {
-			attr.setAlias(db, opts.Alias1)
+			attr.setAlias(ctx, store, opts.Alias1)
 		} else if len(opts.Alias2) > 0 {
-			attr.setAlias(db, opts.Alias2)
+			attr.setAlias(ctx, store, opts.Alias2)
 		}
 	} else if len(opts.Alias1) > 0 && len(opts.Alias2) > 0 {
-		attr1 := findAttributeByAlias(db, opts.Alias1, true)
-		attr2 := findAttributeByAlias(db, opts.Alias2, true)
+		attr1 := findAttributeByAlias(ctx, store, opts.Alias1, true)
+		attr2 := findAttributeByAlias(ctx, store, opts.Alias2, true)
 
 		if attr1.getID() > 0 && attr2.getID() <= 0 {
-			attr1.setAlias(db, opts.Alias2)
+			attr1.setAlias(ctx, store, opts.Alias2)
 		} else if attr1.getID() <= 0 && attr2.getID() > 0 {
-			attr2.setAlias(db, opts.Alias1)
+			attr2.setAlias(ctx, store, opts.Alias1)
 		} else {
 			log.Println("not changing anything", attr1.getID(), attr2.getID())
 		}
@@ -269,21 +347,21 @@ func cmdAlias(db *sql.DB, opts options) bool {
 	return true
 }
 
-func cmdEdit(db *sql.DB, opts options) bool {
+func cmdEdit(ctx context.Context, store eton.Store, opts options) bool {
 	var totalUpdated int64
 
 	if len(opts.IDs) == 0 && len(opts.Aliases) == 0 {
-		opts.IDs = append(opts.IDs, int64(getLastAttrID(db)))
+		opts.IDs = append(opts.IDs, int64(getLastAttrID(ctx, store)))
 	}
 
 	for _, id := range opts.IDs {
-		attr := findAttributeByID(db, id)
-		totalUpdated += attr.edit(db)
+		attr := findAttributeByID(ctx, store, id)
+		totalUpdated += attr.edit(ctx, store, opts)
 	}
 
 	for _, alias := range opts.Aliases {
-		attr := findAttributeByAlias(db, alias, false)
-		totalUpdated += attr.edit(db)
+		attr := findAttributeByAlias(ctx, store, alias, false)
+		totalUpdated += attr.edit(ctx, store, opts)
 	}
 
 	if opts.Verbose {
@@ -293,38 +371,86 @@ func cmdEdit(db *sql.DB, opts options) bool {
 	return true
 }
 
-func cmdRm(db *sql.DB, opts options) bool {
+// cmdRm removes notes, it exits with status 1 if a note was not removed
+// because it has notes under it.
+func cmdRm(ctx context.Context, store eton.Store, opts options) bool {
 
 	var totalUpdated int64
+	var refused bool
+
+	rm := func(attr attrStruct) int64 {
+		if attr.getID() == -1 {
+			return 0
+		}
+		rowsAffected, err := store.Remove(ctx, attr.getID(), opts.Recursive)
+		if errors.Is(err, eton.ErrHasChildren) {
+			count, err := store.CountChildren(ctx, attr.getID())
+			check(err)
+			them := "them"
+			if count == 1 {
+				them = "it"
+			}
+			fmt.Fprintf(os.Stderr, "%s has %s under it, use -r to remove %s too\n", attr.getIdentifier(), pluralNotes(count), them)
+			refused = true
+			return 0
+		}
+		if errors.Is(err, eton.ErrNotFound) {
+			fmt.Fprintf(os.Stderr, "%s is removed already\n", attr.getIdentifier())
+			return 0
+		}
+		check(err)
+		return rowsAffected
+	}
 
 	for _, id := range opts.IDs {
-		attr := findAttributeByID(db, id)
-		totalUpdated += attr.rm(db)
+		attr := findAttributeByID(ctx, store, id)
+		totalUpdated += rm(attr)
 	}
 
 	for _, alias := range opts.Aliases {
-		attr := findAttributeByAlias(db, alias, true)
-		totalUpdated += attr.rm(db)
+		attr := findAttributeByAliasStrict(ctx, store, alias)
+		totalUpdated += rm(attr)
 	}
 
 	if totalUpdated > 0 {
 		fmt.Println(totalUpdated, "deleted")
 	}
+	if refused {
+		os.Exit(1)
+	}
 
 	return true
 }
 
-func cmdUnrm(db *sql.DB, opts options) bool {
+// pluralNotes returns "1 note" or "<n> notes".
+func pluralNotes(n int) string {
+	if n == 1 {
+		return "1 note"
+	}
+	return fmt.Sprintf("%d notes", n)
+}
+
+func cmdUnrm(ctx context.Context, store eton.Store, opts options) bool {
 	var totalUpdated int64
 
+	unrm := func(id int64) int64 {
+		rowsAffected, err := store.Unremove(ctx, id, opts.Recursive)
+		if errors.Is(err, eton.ErrNotFound) {
+			return 0
+		}
+		check(err)
+		return rowsAffected
+	}
+
 	for _, id := range opts.IDs {
-		attr := findAttributeByID(db, id)
-		totalUpdated += attr.unrm(db)
+		totalUpdated += unrm(id)
 	}
 
 	for _, alias := range opts.Aliases {
-		attr := findAttributeByAlias(db, alias, true)
-		totalUpdated += attr.unrm(db)
+		attr := findAttributeByAlias(ctx, store, alias, true)
+		if attr.getID() != -1 {
+			totalUpdated += unrm(attr.getID())
+		}
 	}
 
 	if totalUpdated > 0 {
@@ -334,50 +460,291 @@ func cmdUnrm(db *sql.DB, opts options) bool {
 	return true
 }
 
-func cmdInit(db *sql.DB) bool {
-	initializeDatabase(db)
+func cmdMv(ctx context.Context, store eton.Store, opts options) bool {
+	var totalUpdated int64
+	var parentID int64 = -1
+
+	if len(opts.Parent) > 0 {
+		parentID = findParent(ctx, store, opts.Parent).getID()
+	}
+
+	setParent := func(attr attrStruct) int64 {
+		if attr.getID() == -1 {
+			return 0
+		}
+		rowsAffected, err := store.SetParent(ctx, attr.getID(), parentID)
+		if errors.Is(err, eton.ErrCycle) {
+			log.Fatalf("cannot move %s under itself", attr.getIdentifier())
+		}
+		check(err)
+		return rowsAffected
+	}
+
+	for _, id := range opts.IDs {
+		attr := findAttributeByID(ctx, store, id)
+		totalUpdated += setParent(attr)
+	}
+
+	for _, alias := range opts.Aliases {
+		attr := findAttributeByAlias(ctx, store, alias, true)
+		totalUpdated += setParent(attr)
+	}
+
+	fmt.Println(totalUpdated, "moved")
+	return true
+}
+
+func findParent(ctx context.Context, store eton.Store, identifier string) attrStruct {
+	parent := findAttributeByAliasOrID(ctx, store, identifier)
+	if parent.getID() == -1 {
+		log.Fatalf("parent \"%s\" not found", identifier)
+	}
+	return parent
+}
+
+func cmdInit(dbfile string) bool {
+	fmt.Fprintln(out, "repository initiated at", dbfile)
 	return true
 }
 
-func cmdMark(db *sql.DB, opts options) bool {
+func cmdMark(ctx context.Context, store eton.Store, opts options) bool {
 	var totalUpdated int64
 	for _, id := range opts.IDs {
-		attr := findAttributeByID(db, id)
-		totalUpdated += attr.setMark(db, 1)
+		attr := findAttributeByID(ctx, store, id)
+		totalUpdated += setMark(ctx, store, attr, 1)
 	}
 
 	for _, alias := range opts.Aliases {
-		attr := findAttributeByAlias(db, alias, false)
-		totalUpdated += attr.setMark(db, 1)
+		attr := findAttributeByAliasStrict(ctx, store, alias)
+		totalUpdated += setMark(ctx, store, attr, 1)
 	}
 
 	fmt.Println(totalUpdated, "marked")
 	return true
 }
 
-func cmdUnmark(db *sql.DB, opts options) bool {
+func cmdUnmark(ctx context.Context, store eton.Store, opts options) bool {
 	var totalUpdated int64
 	for _, id := range opts.IDs {
-		attr := findAttributeByID(db, id)
-		totalUpdated += attr.setMark(db, 0)
+		attr := findAttributeByID(ctx, store, id)
+		totalUpdated += setMark(ctx, store, attr, 0)
 	}
 
 	for _, alias := range opts.Aliases {
-		attr := findAttributeByAlias(db, alias, false)
-		totalUpdated += attr.setMark(db, 0)
+		attr := findAttributeByAlias(ctx, store, alias, false)
+		totalUpdated += setMark(ctx, store, attr, 0)
 	}
 
 	fmt.Println(totalUpdated, "marked")
 	return true
 }
 
+func setMark(ctx context.Context, store eton.Store, attr attrStruct, mark int) int64 {
+	if attr.getID() == -1 {
+		return 0
+	}
+	rowsAffected, err := store.SetMark(ctx, attr.getID(), mark)
+	if errors.Is(err, eton.ErrNotFound) {
+		fmt.Fprintf(os.Stderr, "%s is removed, use unrm to recover it\n", attr.getIdentifier())
+		return 0
+	}
+	check(err)
+	return rowsAffected
+}
+
+func cmdTag(ctx context.Context, store eton.Store, opts options) bool {
+	attr := findAttributeFromOpts(ctx, store, opts)
+	totalUpdated, err := store.AddTags(ctx, attr.getID(), opts.Tags)
+	check(err)
+	fmt.Println(totalUpdated, "tagged")
+	return true
+}
+
+func cmdUntag(ctx context.Context, store eton.Store, opts options) bool {
+	attr := findAttributeFromOpts(ctx, store, opts)
+	totalUpdated, err := store.RemoveTags(ctx, attr.getID(), opts.Tags)
+	check(err)
+	fmt.Println(totalUpdated, "untagged")
+	return true
+}
+
+func cmdTags(ctx context.Context, store eton.Store, w *tabwriter.Writer) bool {
+	counts, err := store.TagCounts(ctx)
+	check(err)
+	for _, count := range counts {
+		fmt.Fprintf(w, "%s\t%d\n", color("#"+count.Tag, themeColor("tag")), count.Count)
+	}
+	w.Flush()
+	return true
+}
+
+// cmdNotebooks lists the default database and the notebooks of the config
+// file, with their note counts. The open one is marked with a "*".
+func cmdNotebooks(ctx context.Context, store eton.Store, w *tabwriter.Writer, dbfile string) bool {
+	names := append([]string{"default"}, cfg.notebookNames()...)
+	paths := cfg.notebooks()
+	paths["default"] = databasePath("", "", config{})
+
+	for _, name := range names {
+		path := paths[name]
+		current := " "
+		if path == dbfile {
+			current = "*"
+		}
+
+		count := "missing"
+		if path == dbfile {
+			n, err := store.Count(ctx)
+			check(err)
+			count = strconv.Itoa(n)
+		} else if _, err := os.Stat(path); err == nil {
+			n, err := countNotes(ctx, path)
+			if err != nil {
+				count = "error: " + err.Error()
+			} else {
+				count = strconv.Itoa(n)
+			}
+		}
+
+		fmt.Fprintf(w, "%s %s\t%s\t%s\n", current, color(name, "yellow+b"), count, path)
+	}
+	w.Flush()
+	return true
+}
+
+func countNotes(ctx context.Context, path string) (int, error) {
+	store, err := eton.Open(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+	return store.Count(ctx)
+}
+
+func cmdBacklinks(ctx context.Context, store eton.Store, w *tabwriter.Writer, opts options) bool {
+	attr := findAttributeFromOpts(ctx, store, opts)
+	backlinks, err := store.Backlinks(ctx, attr.getID())
+	check(err)
+	for _, backlink := range attrsFromStore(backlinks) {
+		backlink.print(w, false, 0, matchOptions{})
+	}
+	return true
+}
+
+func cmdLog(ctx context.Context, store eton.Store, w *tabwriter.Writer, opts options) bool {
+	attr := findAttributeFromOpts(ctx, store, opts)
+	for _, rev := range listRevisions(ctx, store, attr) {
+		title := attrStruct{eton.Attr{ValueText: rev.ValueText}}.title()
+		fmt.Fprintf(w, "%s\t%s\t%s\n", color(fmt.Sprintf("r%d", rev.Number), "yellow+b"), rev.CreatedAt.Time.Local().Format(dateLayout()), title)
+	}
+	w.Flush()
+	return true
+}
+
+func cmdDiff(ctx context.Context, store eton.Store, opts options) bool {
+	attr := findAttributeFromOpts(ctx, store, opts)
+	revs := listRevisions(ctx, store, attr)
+	if len(revs) == 0 {
+		log.Fatalf("%s has no revisions", attr.getIdentifier())
+	}
+
+	// default to the changes made by the last revision
+	rev1, rev2 := opts.Rev1, opts.Rev2
+	if rev2 == 0 {
+		rev2 = len(revs)
+	}
+	if rev1 == 0 {
+		rev1 = rev2 - 1
+	}
+
+	from := findRevision(attr, revs, rev1)
+	to := findRevision(attr, revs, rev2)
+	fmt.Fprint(out, unifiedDiff(from.Text(), to.Text(),
+		fmt.Sprintf("%s@r%d", attr.getIdentifier(), rev1),
+		fmt.Sprintf("%s@r%d", attr.getIdentifier(), rev2)))
+	return true
+}
+
+func cmdRevert(ctx context.Context, store eton.Store, opts options) bool {
+	attr := findAttributeFromOpts(ctx, store, opts)
+	rev := findRevision(attr, listRevisions(ctx, store, attr), opts.Rev1)
+
+	if rev.Text() == attr.getTextValue() {
+		fmt.Printf("%s is already at r%d\n", attr.getIdentifier(), rev.Number)
+		return true
+	}
+
+	updateNote(ctx, store, attr.getID(), rev.Text())
+	fmt.Printf("%s reverted to r%d\n", attr.getIdentifier(), rev.Number)
+	return true
+}
+
+// findRevision returns revision number n of attr, the first revision is 1,
+// 0 is the empty revision before it.
+func findRevision(attr attrStruct, revs []eton.Revision, n int) eton.Revision {
+	if n == 0 {
+		return eton.Revision{AttributeID: attr.getID()}
+	}
+	if n < 0 || n > len(revs) {
+		log.Fatalf("%s has no revision r%d, it has %d revisions", attr.getIdentifier(), n, len(revs))
+	}
+	return revs[n-1]
+}
+
+func listRevisions(ctx context.Context, store eton.Store, attr attrStruct) []eton.Revision {
+	revs, err := store.Revisions(ctx, attr.getID())
+	check(err)
+	return revs
+}
+
+// findAttributeFromOpts returns the attribute given as <id>, either an ID or
+// an alias.
+func findAttributeFromOpts(ctx context.Context, store eton.Store, opts options) (attr attrStruct) {
+	if opts.ID > 0 {
+		attr = findAttributeByID(ctx, store, opts.ID)
+	} else {
+		attr = findAttributeByAlias(ctx, store, opts.Alias, false)
+	}
+	if attr.getID() == -1 {
+		if opts.ID > 0 {
+			log.Fatalf("ID:%d not found", opts.ID)
+		}
+		log.Fatalf("alias \"%s\" not found", opts.Alias)
+	}
+	return attr
+}
+
+// findAttributesFromOpts returns the attributes given as <ids>, with their
+// tags.
+func findAttributesFromOpts(ctx context.Context, store eton.Store, opts options) (attrs []attrStruct) {
+	for _, id := range opts.IDs {
+		attr := findAttributeByID(ctx, store, id)
+		if attr.getID() == -1 {
+			log.Fatalf("ID:%d not found", id)
+		}
+		attrs = append(attrs, attr)
+	}
+
+	for _, alias := range opts.Aliases {
+		attr := findAttributeByAlias(ctx, store, alias, false)
+		if attr.getID() == -1 {
+			log.Fatalf("alias \"%s\" not found", alias)
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs
+}
+
 func openEditor(filepath string) bool {
 	var cmd *exec.Cmd
 
-	editor := os.Getenv("EDITOR")
+	editor := cfg.get("editor")
+	if len(editor) == 0 {
+		editor = os.Getenv("EDITOR")
+	}
 
 	if len(editor) > 0 {
-		cmd = exec.Command(editor, filepath)
+		cmd = splitCommand(editor, filepath)
 	} else {
 		if _, err := os.Stat("/usr/bin/sensible-editor"); err == nil {
 			cmd = exec.Command("/usr/bin/sensible-editor", filepath)
@@ -388,10 +755,14 @@ func openEditor(filepath string) bool {
 
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
+
+	stop := cleanupOnSignal()
+	defer stop()
+
 	err := cmd.Run()
 	if err != nil {
 		log.Println("Error:", err)
-		log.Println("File not saved:", filepath)
+		log.Println("Not saved")
 		return false
 	}
 	return true
@@ -409,9 +780,28 @@ func check(e error) {
 	}
 }
 
+// pagerCommand returns the pager in the config file, or $PAGER, or less.
+func pagerCommand() *exec.Cmd {
+	pager := cfg.get("pager")
+	if len(pager) == 0 {
+		pager = os.Getenv("PAGER")
+	}
+	if len(pager) == 0 {
+		return exec.Command("/usr/bin/env", "less")
+	}
+	return splitCommand(pager)
+}
+
+// splitCommand returns a command given as a string with arguments, e.g.
+// "less -R" or "code --wait", followed by args.
+func splitCommand(command string, args ...string) *exec.Cmd {
+	fields := strings.Fields(command)
+	return exec.Command(fields[0], append(fields[1:], args...)...)
+}
+
 func printToLess(text string) {
 	// declare pager
-	cmd := exec.Command("/usr/bin/env", "less")
+	cmd := pagerCommand()
 	// create a pipe (blocking)
 	r, stdin := io.Pipe()
 	// set IOs
@@ -427,7 +817,7 @@ func printToLess(text string) {
 	}()
 
 	// Pass anything to your pipe
-	fmt.Fprintf(stdin, text)
+	io.WriteString(stdin, text)
 
 	// Close stdin (result in pager to exit)
 	stdin.Close()
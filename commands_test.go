@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/siadat/eton/eton"
+)
+
+// openTestStore opens an empty database in a temporary directory.
+func openTestStore(t *testing.T) (context.Context, *eton.SQLiteStore) {
+	t.Helper()
+	ctx := context.Background()
+	store, err := eton.Open(ctx, filepath.Join(t.TempDir(), "eton.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return ctx, store
+}
+
+// createNote creates a top-level note, with an alias unless it is empty.
+func createNote(t *testing.T, ctx context.Context, store eton.Store, text, alias string) int64 {
+	t.Helper()
+	id, err := store.CreateNote(ctx, text, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alias) > 0 {
+		if _, err = store.SetAlias(ctx, id, alias); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id
+}
+
+func TestRmAndMarkRemovedNote(t *testing.T) {
+	ctx, store := openTestStore(t)
+	id := createNote(t, ctx, store, "draft", "foo")
+
+	opts := options{Aliases: []string{"foo"}}
+	cmdRm(ctx, store, opts)
+
+	// the exact alias still finds the removed note, which must not panic
+	cmdRm(ctx, store, opts)
+	cmdRm(ctx, store, options{IDs: []int64{id}})
+	cmdMark(ctx, store, opts)
+
+	removed, err := store.List(ctx, eton.ListOptions{Limit: -1, RootID: -1, Removed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Mark.Int64 != 0 {
+		t.Fatalf("removed notes = %+v, want the unmarked note %d", removed, id)
+	}
+}
+
+func TestEditFileNote(t *testing.T) {
+	ctx, store := openTestStore(t)
+	dir := t.TempDir()
+	id, err := store.AddFile(ctx, "/home/me/todo.txt", []byte("buy milk\n"), 0644, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	editor := filepath.Join(dir, "editor")
+	if err = ioutil.WriteFile(editor, []byte("#!/bin/sh\necho 'buy bread' > \"$1\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("EDITOR", editor)
+	defer os.Unsetenv("EDITOR")
+
+	cmdEdit(ctx, store, options{IDs: []int64{id}})
+
+	attr, err := store.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr.ValueText.String != "/home/me/todo.txt" || string(attr.ValueBlob) != "buy bread\n" {
+		t.Errorf("edited file note = %q, %q, want its path and the new content", attr.ValueText.String, attr.ValueBlob)
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/siadat/eton/eton"
+)
+
+// The config file is a subset of TOML: "key = value" lines grouped in
+// [sections], where value is a quoted string, a number or a boolean, e.g.
+//
+//   [notebooks]
+//   work = "~/Sync/work.etondb"
+//   team = "/mnt/shared/team.etondb"
+//
+// A key in a section is referred to as "section.key", e.g. notebooks.work.
+type config map[string]string
+
+// cfg is the config file, read at startup
+var cfg = config{}
+
+// configSetting is a key of the config file with a default value.
+type configSetting struct {
+	key          string
+	defaultValue string
+	help         string
+	validate     func(value string) error
+}
+
+// configSettings are the keys known to "eton config". Keys of the
+// [notebooks] section are accepted too.
+var configSettings = []configSetting{
+	{"editor", "", "editor command, overrides $EDITOR", nil},
+	{"pager", "", "pager used by show, overrides $PAGER, less if both are empty", nil},
+	{"limit", "10", `default --limit of ls and grep, a number or "all"`, validateLimit},
+	{"date_layout", "06/01/02 03:04pm", "Go time layout of dates, see https://golang.org/pkg/time/#pkg-constants", validateNotEmpty},
+	{"trash.retention", "", "removed notes are purged after this age, e.g. 30d, never if empty", validateAge},
+	{"colors.id", "yellow+b", "id or alias of listed notes", nil},
+	{"colors.marked", "green", "id or alias of marked notes", nil},
+	{"colors.tag", "cyan", "#tags", nil},
+	{"colors.match", "black+b:green", "matches of grep filters", nil},
+	{"colors.context", "black", "indentation of matching lines", nil},
+}
+
+// legacyDatabaseFilename is where previous versions kept the database, in the
+// home directory. It is still used if it exists.
+const legacyDatabaseFilename = ".etondb"
+
+// configPath returns $XDG_CONFIG_HOME/eton/config, or ~/.config/eton/config
+// if XDG_CONFIG_HOME is not set.
+func configPath() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if len(base) == 0 {
+		base = filepath.Join(homeDir(), ".config")
+	}
+	return filepath.Join(base, "eton", "config")
+}
+
+// dataDir returns $XDG_DATA_HOME/eton, or ~/.local/share/eton if
+// XDG_DATA_HOME is not set.
+func dataDir() string {
+	base := os.Getenv("XDG_DATA_HOME")
+	if len(base) == 0 {
+		base = filepath.Join(homeDir(), ".local", "share")
+	}
+	return filepath.Join(base, "eton")
+}
+
+// loadConfig reads the config file, a missing file is an empty config.
+func loadConfig() config {
+	content, err := ioutil.ReadFile(configPath())
+	if os.IsNotExist(err) {
+		return config{}
+	}
+	check(err)
+
+	cfg, err := parseConfig(string(content))
+	if err != nil {
+		log.Fatalf("%s: %v", configPath(), err)
+	}
+	return cfg
+}
+
+func parseConfig(content string) (config, error) {
+	cfg := config{}
+	section := ""
+
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			end := strings.Index(line, "]")
+			if end == -1 || !validConfigKey(strings.TrimSpace(line[1:end])) {
+				return nil, fmt.Errorf("line %d: invalid section %s", i+1, line)
+			}
+			section = strings.TrimSpace(line[1:end])
+			continue
+		}
+
+		sep := strings.Index(line, "=")
+		if sep == -1 {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		key := strings.TrimSpace(line[:sep])
+		if !validConfigKey(key) {
+			return nil, fmt.Errorf("line %d: invalid key %q", i+1, key)
+		}
+		value, err := parseConfigValue(strings.TrimSpace(line[sep+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+
+		if len(section) > 0 {
+			key = section + "." + key
+		}
+		cfg[key] = value
+	}
+	return cfg, nil
+}
+
+// parseConfigValue returns the value of a "key = value" line, without the
+// quotes and the trailing comment.
+func parseConfigValue(value string) (string, error) {
+	if strings.HasPrefix(value, "'") {
+		end := strings.Index(value[1:], "'")
+		if end == -1 {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		return value[1 : end+1], nil
+	}
+
+	if strings.HasPrefix(value, `"`) {
+		for end := 1; end < len(value); end++ {
+			if value[end] == '\\' {
+				end++
+			} else if value[end] == '"' {
+				return strconv.Unquote(value[:end+1])
+			}
+		}
+		return "", fmt.Errorf("unterminated string %s", value)
+	}
+
+	if comment := strings.Index(value, "#"); comment != -1 {
+		value = strings.TrimSpace(value[:comment])
+	}
+	if len(value) == 0 {
+		return "", fmt.Errorf("missing value")
+	}
+	return value, nil
+}
+
+func validConfigKey(key string) bool {
+	if len(key) == 0 {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// get returns the value of key, or its default value.
+func (cfg config) get(key string) string {
+	if value, ok := cfg[key]; ok {
+		return value
+	}
+	if setting, ok := findConfigSetting(key); ok {
+		return setting.defaultValue
+	}
+	return ""
+}
+
+func findConfigSetting(key string) (configSetting, bool) {
+	for _, setting := range configSettings {
+		if setting.key == key {
+			return setting, true
+		}
+	}
+	return configSetting{}, false
+}
+
+// validateConfigValue returns an error if key is unknown or value is not
+// valid for it.
+func validateConfigValue(key, value string) error {
+	if strings.HasPrefix(key, "notebooks.") && validConfigKey(strings.TrimPrefix(key, "notebooks.")) {
+		return validateNotEmpty(value)
+	}
+	setting, ok := findConfigSetting(key)
+	if !ok {
+		return fmt.Errorf("unknown key %q, see eton config list", key)
+	}
+	if setting.validate != nil {
+		if err := setting.validate(value); err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func validateLimit(value string) error {
+	_, err := parseLimit(value)
+	return err
+}
+
+func validateAge(value string) error {
+	if len(value) == 0 {
+		return nil
+	}
+	_, err := eton.ParseAge(value)
+	return err
+}
+
+func validateNotEmpty(value string) error {
+	if len(value) == 0 {
+		return fmt.Errorf("empty value")
+	}
+	return nil
+}
+
+// parseLimit parses a --limit, "all" is -1.
+func parseLimit(value string) (int, error) {
+	if value == "all" {
+		return -1, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid limit %q, expected a number or \"all\"", value)
+	}
+	return limit, nil
+}
+
+func dateLayout() string {
+	return cfg.get("date_layout")
+}
+
+// themeColor returns the color of an element of the output, e.g. "id".
+func themeColor(name string) string {
+	return cfg.get("colors." + name)
+}
+
+// setConfigValue returns the content of a config file with key set to
+// value. Other lines, including comments, are kept.
+func setConfigValue(content, key, value string) string {
+	section, name := "", key
+	if dot := strings.Index(key, "."); dot != -1 {
+		section, name = key[:dot], key[dot+1:]
+	}
+	line := name + " = " + formatConfigValue(value)
+
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if len(content) == 0 {
+		lines = nil
+	}
+
+	currentSection := ""
+	insertAt := -1 // after the last key of the section
+	if len(section) == 0 {
+		insertAt = 0
+	}
+
+	for i, l := range lines {
+		trimmed := strings.TrimSpace(l)
+		if strings.HasPrefix(trimmed, "[") {
+			end := strings.Index(trimmed, "]")
+			if end != -1 {
+				currentSection = strings.TrimSpace(trimmed[1:end])
+			}
+			if currentSection == section {
+				insertAt = i + 1
+			}
+			continue
+		}
+		if currentSection != section {
+			continue
+		}
+		if sep := strings.Index(trimmed, "="); sep != -1 && !strings.HasPrefix(trimmed, "#") {
+			if strings.TrimSpace(trimmed[:sep]) == name {
+				lines[i] = line
+				return strings.Join(lines, "\n") + "\n"
+			}
+			insertAt = i + 1
+		}
+	}
+
+	if insertAt == -1 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+section+"]", line)
+	} else {
+		lines = append(lines[:insertAt], append([]string{line}, lines[insertAt:]...)...)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// formatConfigValue returns value as written in the config file, integers
+// and booleans are not quoted.
+func formatConfigValue(value string) string {
+	if _, err := strconv.Atoi(value); err == nil || value == "true" || value == "false" {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+// cmdConfig runs "eton config list", "get" and "set".
+func cmdConfig(args map[string]interface{}) bool {
+	switch {
+	case args["list"].(bool):
+		for _, setting := range configSettings {
+			fmt.Fprintf(out, "%s = %s\n", setting.key, formatConfigValue(cfg.get(setting.key)))
+		}
+		var others []string
+		for key := range cfg {
+			if _, ok := findConfigSetting(key); !ok {
+				others = append(others, key)
+			}
+		}
+		sort.Strings(others)
+		for _, key := range others {
+			fmt.Fprintf(out, "%s = %s\n", key, formatConfigValue(cfg[key]))
+		}
+	case args["get"].(bool):
+		key := args["<key>"].(string)
+		if _, ok := cfg[key]; !ok {
+			if _, ok := findConfigSetting(key); !ok {
+				log.Fatalf("%s is not set", key)
+			}
+		}
+		fmt.Fprintln(out, cfg.get(key))
+	case args["set"].(bool):
+		key, value := args["<key>"].(string), args["<value>"].(string)
+		if err := validateConfigValue(key, value); err != nil {
+			log.Fatal(err)
+		}
+
+		path := configPath()
+		content, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+		check(os.MkdirAll(filepath.Dir(path), 0700))
+		check(ioutil.WriteFile(path, []byte(setConfigValue(string(content), key, value)), 0600))
+	}
+	return true
+}
+
+// notebooks returns the paths of the notebooks by name.
+func (cfg config) notebooks() map[string]string {
+	notebooks := make(map[string]string)
+	for key, value := range cfg {
+		if strings.HasPrefix(key, "notebooks.") {
+			notebooks[strings.TrimPrefix(key, "notebooks.")] = expandHome(value)
+		}
+	}
+	return notebooks
+}
+
+func (cfg config) notebookNames() []string {
+	var names []string
+	for name := range cfg.notebooks() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// databasePath returns the database to open: the --db flag, the notebook
+// selected with -n, $ETON_DB, or else the default database.
+func databasePath(dbFlag, notebook string, cfg config) string {
+	if len(dbFlag) > 0 {
+		return expandHome(dbFlag)
+	}
+	if len(notebook) > 0 {
+		path, ok := cfg.notebooks()[notebook]
+		if !ok {
+			log.Fatalf("unknown notebook %q, notebooks are defined in the [notebooks] section of %s", notebook, configPath())
+		}
+		return path
+	}
+	if path := os.Getenv("ETON_DB"); len(path) > 0 {
+		return expandHome(path)
+	}
+	return defaultDatabasePath()
+}
+
+// defaultDatabasePath returns ~/.etondb if it exists, or else
+// $XDG_DATA_HOME/eton/eton.db.
+func defaultDatabasePath() string {
+	legacy := filepath.Join(homeDir(), legacyDatabaseFilename)
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy
+	}
+	return filepath.Join(dataDir(), "eton.db")
+}
+
+// expandHome replaces a leading ~ with the home directory.
+func expandHome(path string) string {
+	if path == "~" {
+		return homeDir()
+	}
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(homeDir(), path[2:])
+	}
+	return path
+}
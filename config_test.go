@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig(`
+# comment
+editor = "vim -u NONE"   # trailing comment
+limit = 20
+pager = 'less -R # kept'
+
+[notebooks]
+work = "~/Sync/work.etondb"
+escaped = "a \"b\" \\c"
+
+[trash]
+retention = 30d # unquoted
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"editor":            "vim -u NONE",
+		"limit":             "20",
+		"pager":             "less -R # kept",
+		"notebooks.work":    "~/Sync/work.etondb",
+		"notebooks.escaped": `a "b" \c`,
+		"trash.retention":   "30d",
+	}
+	if fmt.Sprint(map[string]string(cfg)) != fmt.Sprint(want) {
+		t.Errorf("parseConfig = %v, want %v", cfg, want)
+	}
+	if cfg.get("colors.id") != "yellow+b" || cfg.get("unknown") != "" {
+		t.Errorf("defaults: colors.id = %q, unknown = %q", cfg.get("colors.id"), cfg.get("unknown"))
+	}
+
+	for _, content := range []string{
+		"[open",
+		"[bad key]",
+		"no equals sign",
+		"bad.key = 1",
+		`key = "unterminated`,
+		"key = 'unterminated",
+		"key = # nothing",
+	} {
+		if _, err := parseConfig(content); err == nil {
+			t.Errorf("parseConfig(%q) did not fail", content)
+		}
+	}
+}
+
+func TestSetConfigValue(t *testing.T) {
+	tests := []struct {
+		content, key, value, want string
+	}{
+		{"", "limit", "20", "limit = 20\n"},
+		{"# mine\nlimit = 10\n", "limit", "all", "# mine\nlimit = \"all\"\n"},
+		{"editor = \"vi\"\n", "notebooks.work", "~/w.db", "editor = \"vi\"\n\n[notebooks]\nwork = \"~/w.db\"\n"},
+		{"[notebooks]\na = \"1\"\n\n[trash]\n", "notebooks.b", "2", "[notebooks]\na = \"1\"\nb = 2\n\n[trash]\n"},
+		{"limit = 10\n[trash]\nretention = \"1d\"\n", "trash.retention", "30d", "limit = 10\n[trash]\nretention = \"30d\"\n"},
+	}
+	for _, test := range tests {
+		got := setConfigValue(test.content, test.key, test.value)
+		if got != test.want {
+			t.Errorf("setConfigValue(%q, %s, %s) = %q, want %q", test.content, test.key, test.value, got, test.want)
+		}
+		if cfg, err := parseConfig(got); err != nil || cfg[test.key] != test.value {
+			t.Errorf("setConfigValue(%q, %s, %s) reads back %q, %v", test.content, test.key, test.value, cfg[test.key], err)
+		}
+	}
+}
+
+func TestValidateConfigValue(t *testing.T) {
+	tests := []struct {
+		key, value string
+		ok         bool
+	}{
+		{"limit", "all", true},
+		{"limit", "ten", false},
+		{"trash.retention", "", true},
+		{"trash.retention", "30d", true},
+		{"trash.retention", "soon", false},
+		{"notebooks.work", "~/w.db", true},
+		{"notebooks.work", "", false},
+		{"notebooks.bad key", "x", false},
+		{"colour", "red", false},
+	}
+	for _, test := range tests {
+		if err := validateConfigValue(test.key, test.value); (err == nil) != test.ok {
+			t.Errorf("validateConfigValue(%s, %q) = %v, want ok: %v", test.key, test.value, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContextLines = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diffLines returns the edit script turning a into b, computed from the
+// longest common subsequence of lines. Notes are small enough for O(n*m).
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// unifiedDiff formats the differences between a and b in unified format.
+// It returns an empty string if a and b are equal.
+func unifiedDiff(a, b, nameA, nameB string) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var buf strings.Builder
+	lineA, lineB := 1, 1
+
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+			lineA++
+			lineB++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// extend the hunk while changes are closer than 2*context lines
+		end := start
+		for unchanged := 0; end < len(ops) && unchanged <= 2*diffContextLines; end++ {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		for end > start && ops[end-1].kind == ' ' {
+			end--
+		}
+
+		before := start - diffContextLines
+		if before < 0 {
+			before = 0
+		}
+		after := end + diffContextLines
+		if after > len(ops) {
+			after = len(ops)
+		}
+
+		hunkA, hunkB := lineA-(start-before), lineB-(start-before)
+		var countA, countB int
+		var hunk strings.Builder
+		for _, op := range ops[before:after] {
+			switch op.kind {
+			case ' ':
+				countA++
+				countB++
+				fmt.Fprintf(&hunk, " %s\n", op.line)
+			case '-':
+				countA++
+				fmt.Fprintln(&hunk, color("-"+op.line, "red"))
+			case '+':
+				countB++
+				fmt.Fprintln(&hunk, color("+"+op.line, "green"))
+			}
+		}
+
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		fmt.Fprintln(&buf, color(fmt.Sprintf("@@ -%s +%s @@", hunkRange(hunkA, countA), hunkRange(hunkB, countB)), "cyan"))
+		buf.WriteString(hunk.String())
+
+		for _, op := range ops[start:after] {
+			if op.kind != '+' {
+				lineA++
+			}
+			if op.kind != '-' {
+				lineB++
+			}
+		}
+		start = after
+	}
+	return buf.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// an empty range points at the line before it
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(text string) []string {
+	if len(text) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Conflict markers written by merge3
+const (
+	conflictMine   = "<<<<<<< this edit"
+	conflictSep    = "======="
+	conflictTheirs = ">>>>>>> saved meanwhile"
+)
+
+// merge3 merges the changes made to base in mine and in theirs, line by
+// line. Changes to the same lines are kept from both sides between conflict
+// markers, conflicts is the number of such blocks.
+func merge3(base, mine, theirs string) (merged string, conflicts int) {
+	baseLines, mineLines, theirLines := splitLines(base), splitLines(mine), splitLines(theirs)
+	matchMine := matchLines(baseLines, mineLines)
+	matchTheirs := matchLines(baseLines, theirLines)
+
+	var lines []string
+	i, j, k := 0, 0, 0
+	for {
+		// the next base line kept by both sides ends the chunk
+		s := i
+		for s < len(baseLines) && (matchMine[s] == -1 || matchTheirs[s] == -1) {
+			s++
+		}
+		endMine, endTheirs := len(mineLines), len(theirLines)
+		if s < len(baseLines) {
+			endMine, endTheirs = matchMine[s], matchTheirs[s]
+		}
+
+		baseChunk, mineChunk, theirChunk := baseLines[i:s], mineLines[j:endMine], theirLines[k:endTheirs]
+		switch {
+		case equalLines(mineChunk, baseChunk), equalLines(mineChunk, theirChunk):
+			lines = append(lines, theirChunk...)
+		case equalLines(theirChunk, baseChunk):
+			lines = append(lines, mineChunk...)
+		default:
+			conflicts++
+			lines = append(lines, conflictMine)
+			lines = append(lines, mineChunk...)
+			lines = append(lines, conflictSep)
+			lines = append(lines, theirChunk...)
+			lines = append(lines, conflictTheirs)
+		}
+
+		if s == len(baseLines) {
+			break
+		}
+		lines = append(lines, baseLines[s])
+		i, j, k = s+1, endMine+1, endTheirs+1
+	}
+
+	if len(lines) == 0 {
+		return "", conflicts
+	}
+	merged = strings.Join(lines, "\n")
+	if strings.HasSuffix(mine, "\n") || strings.HasSuffix(theirs, "\n") {
+		merged += "\n"
+	}
+	return merged, conflicts
+}
+
+// matchLines returns, for every line of a, the index of the same line in b
+// in their longest common subsequence, or -1 if it was removed.
+func matchLines(a, b []string) []int {
+	match := make([]int, len(a))
+	i, j := 0, 0
+	for _, op := range diffLines(a, b) {
+		switch op.kind {
+		case ' ':
+			match[i] = j
+			i++
+			j++
+		case '-':
+			match[i] = -1
+			i++
+		case '+':
+			j++
+		}
+	}
+	return match
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
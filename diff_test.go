@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"same\n", "same\n", ""},
+		{"a\nb\nc\n", "a\nB\nc\n", "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"", "new\n", "--- old\n+++ new\n@@ -0,0 +1 @@\n+new\n"},
+		{"gone\n", "", "--- old\n+++ new\n@@ -1 +0,0 @@\n-gone\n"},
+	}
+	for _, test := range tests {
+		if got := unifiedDiff(test.a, test.b, "old", "new"); got != test.want {
+			t.Errorf("unifiedDiff(%q, %q) =\n%s\nwant\n%s", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestUnifiedDiffHunks(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 20; i++ {
+		line := strings.Repeat("x", i+1)
+		a = append(a, line)
+		if i == 2 || i == 17 {
+			line += "!"
+		}
+		b = append(b, line)
+	}
+	diff := unifiedDiff(strings.Join(a, "\n")+"\n", strings.Join(b, "\n")+"\n", "old", "new")
+	if hunks := strings.Count(diff, "\n@@ "); hunks != 2 {
+		t.Errorf("changes 15 lines apart are in %d hunks, want 2:\n%s", hunks, diff)
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, mine, theirs string
+		want               string
+		conflicts          int
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", "a\nb\n", "a\nb\n", 0},
+		{"mine only", "a\nb\n", "a\nB\n", "a\nb\n", "a\nB\n", 0},
+		{"theirs only", "a\nb\n", "a\nb\n", "A\nb\n", "A\nb\n", 0},
+		{"different lines", "a\nb\nc\n", "A\nb\nc\n", "a\nb\nC\n", "A\nb\nC\n", 0},
+		{"same change", "a\nb\n", "a\nB\n", "a\nB\n", "a\nB\n", 0},
+		{"both append", "a\n", "a\nmine\n", "a\ntheirs\n", "a\n" + conflictMine + "\nmine\n" + conflictSep + "\ntheirs\n" + conflictTheirs + "\n", 1},
+		{"same line", "a\nb\nc\n", "a\nB1\nc\n", "a\nB2\nc\n", "a\n" + conflictMine + "\nB1\n" + conflictSep + "\nB2\n" + conflictTheirs + "\nc\n", 1},
+		{"removed and kept", "a\nb\nc\n", "a\nc\n", "a\nb\nc\n", "a\nc\n", 0},
+		{"everything removed", "a\n", "", "", "", 0},
+	}
+	for _, test := range tests {
+		merged, conflicts := merge3(test.base, test.mine, test.theirs)
+		if merged != test.want || conflicts != test.conflicts {
+			t.Errorf("%s: merge3 = %q with %d conflicts, want %q with %d", test.name, merged, conflicts, test.want, test.conflicts)
+		}
+	}
+}
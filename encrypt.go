@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/siadat/eton/eton"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// encryptedTitle is listed instead of the first line of encrypted notes
+const encryptedTitle = "(encrypted)"
+
+// isEncrypted reports whether attr is a note encrypted with "eton encrypt".
+func (attr attrStruct) isEncrypted() bool {
+	return eton.IsEncrypted(attr.ValueBlob)
+}
+
+// decryptedValue returns the content of attr, decrypting it if needed.
+func (attr attrStruct) decryptedValue(opts options) string {
+	if !attr.isEncrypted() {
+		return attr.getValue()
+	}
+
+	return attr.decrypt(secretForNote(attr, opts))
+}
+
+func (attr attrStruct) decrypt(secret eton.Secret) string {
+	plaintext, err := eton.Decrypt(attr.ValueBlob, secret)
+	if err != nil {
+		log.Fatalf("cannot decrypt %s: %v", attr.getIdentifier(), err)
+	}
+	return string(plaintext)
+}
+
+// encryptValue returns valueText encrypted with secret.
+func encryptValue(valueText string, secret eton.Secret) []byte {
+	ciphertext, err := eton.Encrypt([]byte(valueText), secret)
+	check(err)
+	return ciphertext
+}
+
+// secretForNote returns the secret attr was encrypted with, read from the
+// key file or the terminal.
+func secretForNote(attr attrStruct, opts options) eton.Secret {
+	if eton.KeyFileRequired(attr.ValueBlob) {
+		if len(keyFilePath(opts)) == 0 {
+			log.Fatalf("%s was encrypted with a key file, pass --key-file or set $ETON_KEY_FILE", attr.getIdentifier())
+		}
+		return readSecret(opts, false)
+	}
+
+	passphrase := readPassphrase(fmt.Sprintf("passphrase for %s: ", attr.getIdentifier()))
+	return eton.Secret{Passphrase: passphrase}
+}
+
+// readSecret returns the key in the key file of opts, or else a passphrase
+// read from the terminal. confirm asks for a new passphrase twice.
+func readSecret(opts options, confirm bool) eton.Secret {
+	if path := keyFilePath(opts); len(path) > 0 {
+		key, err := eton.ReadKeyFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return eton.Secret{Key: key}
+	}
+
+	passphrase := readPassphrase("passphrase: ")
+	if len(passphrase) == 0 {
+		log.Fatal("empty passphrase")
+	}
+	if confirm && !bytes.Equal(passphrase, readPassphrase("passphrase again: ")) {
+		log.Fatal("passphrases do not match")
+	}
+	return eton.Secret{Passphrase: passphrase}
+}
+
+func keyFilePath(opts options) string {
+	if len(opts.KeyFile) > 0 {
+		return opts.KeyFile
+	}
+	return os.Getenv("ETON_KEY_FILE")
+}
+
+// readPassphrase reads a line from the terminal without echoing it. It uses
+// /dev/tty, because STDIN may be the content of a note.
+func readPassphrase(prompt string) []byte {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		log.Fatal("a terminal is needed to read the passphrase, use --key-file instead")
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, prompt)
+	passphrase, err := terminal.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	check(err)
+	return passphrase
+}
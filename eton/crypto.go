@@ -0,0 +1,215 @@
+package eton
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// An encrypted note has no value_text, its value_blob is:
+//
+//   encryptedMagic | mode | salt (16 bytes) | nonce (24 bytes) | secretbox
+//
+// mode is modePassphrase if the key was derived from a passphrase with
+// scrypt and the salt, or modeKeyFile if it was read from a key file, in
+// which case the salt is zero.
+const (
+	encryptedMagic = "ETONENC1"
+	modePassphrase = 'p'
+	modeKeyFile    = 'k'
+
+	saltSize   = 16
+	nonceSize  = 24
+	headerSize = len(encryptedMagic) + 1 + saltSize + nonceSize
+)
+
+var (
+	// ErrDecrypt is returned when a note cannot be decrypted with a secret.
+	ErrDecrypt = errors.New("eton: wrong passphrase or key")
+
+	// ErrEncrypted is returned when updating the value_text of an encrypted
+	// note, use UpdateBlob with a new ciphertext instead.
+	ErrEncrypted = errors.New("eton: note is encrypted")
+)
+
+// Secret is what notes are encrypted with, a passphrase or a 32-byte key.
+type Secret struct {
+	Passphrase []byte
+	Key        *[32]byte // read with ReadKeyFile, used instead of Passphrase
+}
+
+// IsEncrypted reports whether value_blob holds an encrypted note.
+func IsEncrypted(valueBlob []byte) bool {
+	return len(valueBlob) >= headerSize && bytes.HasPrefix(valueBlob, []byte(encryptedMagic))
+}
+
+// KeyFileRequired reports whether an encrypted note was encrypted with a key
+// file rather than a passphrase.
+func KeyFileRequired(valueBlob []byte) bool {
+	return IsEncrypted(valueBlob) && valueBlob[len(encryptedMagic)] == modeKeyFile
+}
+
+// ReadKeyFile reads a key file, which holds 32 random bytes either raw or
+// hex encoded, e.g. created with "head -c 32 /dev/urandom > ~/.eton.key".
+func ReadKeyFile(path string) (*[32]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoded, err := hex.DecodeString(strings.TrimSpace(string(content))); err == nil {
+		content = decoded
+	}
+	if len(content) != 32 {
+		return nil, fmt.Errorf("key file %s must contain 32 bytes, raw or hex encoded", path)
+	}
+
+	var key [32]byte
+	copy(key[:], content)
+	return &key, nil
+}
+
+// Encrypt returns plaintext encrypted with secret, in the format stored in
+// value_blob.
+func Encrypt(plaintext []byte, secret Secret) ([]byte, error) {
+	header := make([]byte, headerSize)
+	copy(header, encryptedMagic)
+	salt := header[len(encryptedMagic)+1 : len(encryptedMagic)+1+saltSize]
+	var nonce [nonceSize]byte
+
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+	copy(header[headerSize-nonceSize:], nonce[:])
+
+	mode := byte(modeKeyFile)
+	if secret.Key == nil {
+		mode = modePassphrase
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, err
+		}
+	}
+	header[len(encryptedMagic)] = mode
+
+	key, err := deriveKey(mode, salt, secret)
+	if err != nil {
+		return nil, err
+	}
+	return secretbox.Seal(header, plaintext, &nonce, key), nil
+}
+
+// Decrypt returns the plaintext of a value_blob written by Encrypt.
+func Decrypt(valueBlob []byte, secret Secret) ([]byte, error) {
+	if !IsEncrypted(valueBlob) {
+		return nil, errors.New("eton: note is not encrypted")
+	}
+
+	mode := valueBlob[len(encryptedMagic)]
+	if mode == modeKeyFile && secret.Key == nil {
+		return nil, fmt.Errorf("%w: note was encrypted with a key file", ErrDecrypt)
+	}
+
+	salt := valueBlob[len(encryptedMagic)+1 : len(encryptedMagic)+1+saltSize]
+	var nonce [nonceSize]byte
+	copy(nonce[:], valueBlob[headerSize-nonceSize:headerSize])
+
+	key, err := deriveKey(mode, salt, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, ok := secretbox.Open(nil, valueBlob[headerSize:], &nonce, key)
+	if !ok {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func deriveKey(mode byte, salt []byte, secret Secret) (*[32]byte, error) {
+	switch mode {
+	case modeKeyFile:
+		return secret.Key, nil
+	case modePassphrase:
+		derived, err := scrypt.Key(secret.Passphrase, salt, 1<<15, 8, 1, 32)
+		if err != nil {
+			return nil, err
+		}
+		var key [32]byte
+		copy(key[:], derived)
+		return &key, nil
+	}
+	return nil, fmt.Errorf("eton: unknown encryption mode %q", mode)
+}
+
+// isEncrypted reports whether the note with the given ID is encrypted.
+func (s *SQLiteStore) isEncrypted(ctx context.Context, id int64) (encrypted bool, err error) {
+	err = s.db.QueryRowContext(ctx, "SELECT value_blob IS NOT NULL AND substr(value_blob, 1, ?) = CAST(? AS BLOB) FROM attributes WHERE id = ?",
+		len(encryptedMagic), encryptedMagic, id).Scan(&encrypted)
+	if err == sql.ErrNoRows {
+		return false, ErrNotFound
+	}
+	return encrypted, err
+}
+
+// SetEncrypted replaces the content of a note with its ciphertext. The
+// plaintext is also removed from the revisions, the #tags and [[links]]
+// parsed from it, and the full-text index. secure_delete overwrites the
+// freed pages, so that the plaintext does not linger in the database file.
+func (s *SQLiteStore) SetEncrypted(ctx context.Context, id int64, ciphertext []byte) (count int64, err error) {
+	if !IsEncrypted(ciphertext) {
+		return 0, errors.New("eton: ciphertext was not returned by Encrypt")
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, "PRAGMA secure_delete = ON"); err != nil {
+		return 0, err
+	}
+	defer conn.ExecContext(context.Background(), "PRAGMA secure_delete = OFF")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE attributes SET value_text = NULL, value_blob = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", ciphertext, id)
+	if count, err = rowsAffected(result, err); err != nil || count == 0 {
+		return count, err
+	}
+
+	for _, query := range []string{
+		"DELETE FROM revisions WHERE attribute_id = ?",
+		"DELETE FROM tags WHERE attribute_id = ? AND from_body = 1",
+		"DELETE FROM links WHERE source_id = ?",
+	} {
+		if _, err = tx.ExecContext(ctx, query, id); err != nil {
+			return 0, err
+		}
+	}
+
+	if s.fullTextSearch {
+		// merge the index segments, dropping the deleted tokens
+		if err = s.syncFullText(ctx, tx); err != nil {
+			return 0, err
+		}
+		if _, err = tx.ExecContext(ctx, "INSERT INTO attributes_fts (attributes_fts) VALUES ('optimize')"); err != nil {
+			return 0, err
+		}
+	}
+	return count, tx.Commit()
+}
@@ -0,0 +1,117 @@
+package eton
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptPassphrase(t *testing.T) {
+	secret := Secret{Passphrase: []byte("correct horse")}
+	ciphertext, err := Encrypt([]byte("launch codes"), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(ciphertext) || KeyFileRequired(ciphertext) || bytes.Contains(ciphertext, []byte("launch")) {
+		t.Fatalf("Encrypt = %q, want an encrypted passphrase note", ciphertext)
+	}
+
+	if plaintext, err := Decrypt(ciphertext, secret); err != nil || string(plaintext) != "launch codes" {
+		t.Errorf("Decrypt = %q, %v, want the plaintext", plaintext, err)
+	}
+	if _, err := Decrypt(ciphertext, Secret{Passphrase: []byte("wrong horse")}); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Decrypt with a wrong passphrase = %v, want ErrDecrypt", err)
+	}
+
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := Decrypt(tampered, secret); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Decrypt of a modified ciphertext = %v, want ErrDecrypt", err)
+	}
+
+	// a new salt and nonce every time
+	again, err := Encrypt([]byte("launch codes"), secret)
+	if err != nil || bytes.Equal(again[:headerSize], ciphertext[:headerSize]) {
+		t.Errorf("encrypting twice reused the salt and nonce, %v", err)
+	}
+}
+
+func TestEncryptKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	raw := bytes.Repeat([]byte{7}, 32)
+	rawPath, hexPath, shortPath := filepath.Join(dir, "raw"), filepath.Join(dir, "hex"), filepath.Join(dir, "short")
+	for path, content := range map[string][]byte{
+		rawPath:   raw,
+		hexPath:   []byte(hex.EncodeToString(raw) + "\n"),
+		shortPath: raw[:16],
+	} {
+		if err := ioutil.WriteFile(path, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key, err := ReadKeyFile(rawPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hexKey, err := ReadKeyFile(hexPath); err != nil || *hexKey != *key {
+		t.Errorf("ReadKeyFile(hex) = %x, %v, want %x", hexKey, err, key)
+	}
+	if _, err := ReadKeyFile(shortPath); err == nil {
+		t.Error("ReadKeyFile of 16 bytes did not fail")
+	}
+
+	ciphertext, err := Encrypt([]byte("secret"), Secret{Key: key})
+	if err != nil || !KeyFileRequired(ciphertext) {
+		t.Fatalf("Encrypt with a key = %v, key file required: %v", err, KeyFileRequired(ciphertext))
+	}
+	if plaintext, err := Decrypt(ciphertext, Secret{Key: key}); err != nil || string(plaintext) != "secret" {
+		t.Errorf("Decrypt = %q, %v, want the plaintext", plaintext, err)
+	}
+	if _, err := Decrypt(ciphertext, Secret{Passphrase: []byte("secret")}); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Decrypt with a passphrase = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestSetEncrypted(t *testing.T) {
+	ctx, s := openTestStore(t)
+	id := createNote(t, ctx, s, "launch codes #secret [[other]]", "")
+	if _, err := s.Update(ctx, id, "launch codes v2 #secret [[other]]"); err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := Encrypt([]byte("launch codes v2"), Secret{Passphrase: []byte("pw")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.SetEncrypted(ctx, id, []byte("not a ciphertext")); err == nil {
+		t.Error("SetEncrypted with a plaintext did not fail")
+	}
+	if n, err := s.SetEncrypted(ctx, id, ciphertext); err != nil || n != 1 {
+		t.Fatalf("SetEncrypted = %d, %v", n, err)
+	}
+
+	attr, err := s.Get(ctx, id)
+	if err != nil || attr.ValueText.Valid || !IsEncrypted(attr.ValueBlob) {
+		t.Errorf("encrypted note = %+v, %v, want no value_text", attr, err)
+	}
+	for _, query := range []string{
+		"SELECT count(*) FROM revisions WHERE attribute_id = ?",
+		"SELECT count(*) FROM tags WHERE attribute_id = ?",
+		"SELECT count(*) FROM links WHERE source_id = ?",
+	} {
+		var count int
+		if err = s.db.QueryRow(query, id).Scan(&count); err != nil || count != 0 {
+			t.Errorf("%s = %d, %v, want the plaintext gone", query, count, err)
+		}
+	}
+	if got := listIDs(t, s, "launch"); len(got) != 0 {
+		t.Errorf("searching the plaintext finds %v", got)
+	}
+	if _, err = s.Update(ctx, id, "plaintext"); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Update of an encrypted note = %v, want ErrEncrypted", err)
+	}
+}
@@ -0,0 +1,263 @@
+// Package eton stores notes in an SQLite database. It is the data layer of
+// the eton command, and can be embedded in other tools:
+//
+//	store, err := eton.Open(ctx, filepath.Join(home, ".etondb"))
+//	if err != nil {
+//		return err
+//	}
+//	defer store.Close()
+//
+//	attr, err := store.Find(ctx, "procs")
+//	if errors.Is(err, eton.ErrNotFound) {
+//		...
+//	}
+package eton
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no attribute matches an ID or alias.
+	ErrNotFound = errors.New("eton: not found")
+
+	// ErrAliasTaken is returned when an alias belongs to another attribute.
+	ErrAliasTaken = errors.New("eton: alias is taken")
+
+	// ErrInvalidAlias is returned for an alias without a non-numeric character.
+	ErrInvalidAlias = errors.New("eton: alias must contain a non-numeric character")
+
+	// ErrHasChildren is returned when removing a note with notes under it
+	// without removing them too.
+	ErrHasChildren = errors.New("eton: note has notes under it")
+
+	// ErrCycle is returned when moving a note under itself or its descendants.
+	ErrCycle = errors.New("eton: cannot move a note under itself")
+
+	// ErrConflict is returned by the UpdateIfVersion methods when a note was
+	// modified since the version the update is based on.
+	ErrConflict = errors.New("eton: note was modified concurrently")
+
+	// ErrSchemaTooNew is returned when opening a database created by a newer
+	// version of eton.
+	ErrSchemaTooNew = errors.New("eton: database schema is newer than this version of eton")
+)
+
+// Attr holds the data fetched from a row of the attributes table.
+// Only 1 ValueXxx field should have value, the others should be nil
+type Attr struct {
+	// Meta
+	ID        sql.NullInt64
+	ParentID  sql.NullInt64
+	Name      sql.NullString
+	Alias     sql.NullString
+	Path      sql.NullString
+	Frequency sql.NullInt64
+	Mark      sql.NullInt64
+	Tags      []string
+	Depth     int   // depth in the tree returned by a recursive List
+	Version   int64 // incremented by every change to the content
+
+	// Values
+	ValueText sql.NullString
+	ValueBlob []byte
+	ValueInt  sql.NullInt64
+	ValueReal sql.NullFloat64
+	ValueTime time.Time
+
+	// Files added with AddFile
+	FileMode       sql.NullInt64 // permission bits
+	FileModifiedAt NullTime
+	MimeType       sql.NullString // see DetectMimeType
+
+	// Timestamps
+	CreatedAt  NullTime
+	UpdatedAt  NullTime
+	AccessedAt NullTime
+	DeletedAt  NullTime
+}
+
+// Revision is a version of a note's value_text.
+type Revision struct {
+	ID          int64
+	AttributeID int64
+	Number      int // 1 for the first revision of a note
+	ValueText   sql.NullString
+	CreatedAt   NullTime
+}
+
+// TagCount is a tag and the number of notes tagged with it.
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// ListOptions selects the attributes returned by Store.List.
+type ListOptions struct {
+	// Filters are joined into a query, see ParseQuery. Plain words are
+	// ANDed together, a word is matched as a prefix. An invalid query
+	// results in a *QueryError.
+	Filters []string
+
+	// Patterns are regular expressions, in the syntax of the regexp
+	// package, that the content or the alias must match. They are ANDed
+	// with each other and with Filters.
+	Patterns []string
+
+	Limit  int // -1 for no limit
+	Offset int
+
+	// Paged applies Limit and Offset to searches too, which otherwise list
+	// every match.
+	Paged bool
+
+	// RootID lists the notes directly under a note, -1 for the top level.
+	// Filters search notes at any depth.
+	RootID int64
+
+	// Recursive lists the notes under every listed note after it.
+	Recursive bool
+
+	// Removed lists removed notes instead of the others.
+	Removed bool
+
+	// MarkedOnly only lists marked notes.
+	MarkedOnly bool
+
+	// Since and Until, unless zero, only list notes last modified in
+	// [Since, Until). Like filters, they search notes at any depth.
+	Since time.Time
+	Until time.Time
+
+	// CreatedSince and CreatedUntil are Since and Until for the creation
+	// time.
+	CreatedSince time.Time
+	CreatedUntil time.Time
+
+	// Sort is one of SortOrders, the default is "frecency". Searches are
+	// ranked by relevance, then frecency, unless Sort is set.
+	Sort string
+}
+
+// Store is the interface to a database of notes. IDs of attributes that do
+// not exist, or are removed, result in ErrNotFound unless noted otherwise.
+type Store interface {
+	// Get returns the attribute with the given ID.
+	Get(ctx context.Context, id int64) (Attr, error)
+
+	// FindByAlias returns the attribute with the given alias. Unless exact
+	// is true, it falls back to the best fuzzy match of the notes that are
+	// not removed, or returns an *AmbiguousError if there is no clear best.
+	FindByAlias(ctx context.Context, alias string, exact bool) (Attr, error)
+
+	// Find returns the attribute with the given alias, or else ID, or else
+	// the best fuzzy match of the alias like FindByAlias.
+	Find(ctx context.Context, identifier string) (Attr, error)
+
+	// MatchAlias returns every note, not removed, whose alias matches alias
+	// fuzzily, best match first. See PickMatch.
+	MatchAlias(ctx context.Context, alias string) ([]AliasMatch, error)
+
+	// Last returns the most recently created or updated note.
+	Last(ctx context.Context) (Attr, error)
+
+	// List returns the attributes selected by opts, best matches first.
+	List(ctx context.Context, opts ListOptions) ([]Attr, error)
+
+	// ListAll returns every attribute, including removed ones, by ID.
+	ListAll(ctx context.Context) ([]Attr, error)
+
+	// CreateNote creates a note, parentID is -1 for a top-level note.
+	CreateNote(ctx context.Context, valueText string, parentID int64) (int64, error)
+
+	// AddFile stores the content of the file at path, with its permission
+	// bits, modification time and MIME type.
+	AddFile(ctx context.Context, path string, content []byte, mode os.FileMode, modTime time.Time) (int64, error)
+
+	// Insert creates an attribute from all the fields of attr, an invalid ID
+	// lets the database choose one.
+	Insert(ctx context.Context, attr Attr) (int64, error)
+
+	// Update replaces the content of a note, or returns ErrEncrypted.
+	Update(ctx context.Context, id int64, valueText string) (int64, error)
+
+	// UpdateBlob replaces the content of a file, removed or not.
+	UpdateBlob(ctx context.Context, id int64, valueBlob []byte) (int64, error)
+
+	// UpdateIfVersion replaces the content of a note only if its Version is
+	// still version, and returns the new version. Otherwise it returns
+	// ErrConflict.
+	UpdateIfVersion(ctx context.Context, id int64, valueText string, version int64) (int64, error)
+
+	// UpdateBlobIfVersion is UpdateIfVersion for files and encrypted notes.
+	UpdateBlobIfVersion(ctx context.Context, id int64, valueBlob []byte, version int64) (int64, error)
+
+	// SetEncrypted replaces the content of a note with a ciphertext returned
+	// by Encrypt, and removes every trace of the plaintext.
+	SetEncrypted(ctx context.Context, id int64, ciphertext []byte) (int64, error)
+
+	// SetAlias sets the alias of an attribute, or unsets it if alias is
+	// empty. Links to the previous alias are rewritten, it returns the
+	// number of notes rewritten.
+	SetAlias(ctx context.Context, id int64, alias string) (int64, error)
+
+	// SetMark sets the mark of a note, 0 unmarks it.
+	SetMark(ctx context.Context, id int64, mark int) (int64, error)
+
+	// SetParent moves a note, removed or not, under another, or to the top
+	// level if parentID is -1.
+	SetParent(ctx context.Context, id int64, parentID int64) (int64, error)
+
+	// Count returns the number of notes that are not removed.
+	Count(ctx context.Context) (int, error)
+
+	// CountChildren returns the number of notes directly under a note.
+	CountChildren(ctx context.Context, id int64) (int, error)
+
+	// Remove marks a note as removed. Without recursive, removing a note
+	// with notes under it returns ErrHasChildren.
+	Remove(ctx context.Context, id int64, recursive bool) (int64, error)
+
+	// Unremove recovers a removed note. It returns 0 without an error if
+	// the note exists but is not removed.
+	Unremove(ctx context.Context, id int64, recursive bool) (int64, error)
+
+	// Trash returns the removed notes with their sizes, the last removed
+	// first.
+	Trash(ctx context.Context) ([]TrashItem, error)
+
+	// Purge deletes removed notes for good: the given ones and the removed
+	// notes under them, or all of them if ids is empty, and only the ones
+	// removed before removedBefore unless it is zero.
+	Purge(ctx context.Context, ids []int64, removedBefore time.Time) (int64, error)
+
+	// Vacuum releases the space freed by Purge, it returns the number of
+	// bytes reclaimed.
+	Vacuum(ctx context.Context) (int64, error)
+
+	// SetTracking enables or disables counting the notes returned by Get,
+	// Find, FindByAlias and Last as accesses.
+	SetTracking(enabled bool)
+
+	Tags(ctx context.Context, id int64) ([]string, error)
+	AddTags(ctx context.Context, id int64, tags []string) (int64, error)
+	RemoveTags(ctx context.Context, id int64, tags []string) (int64, error)
+	TagCounts(ctx context.Context) ([]TagCount, error)
+
+	// Backlinks returns the notes with a [[link]] to a note.
+	Backlinks(ctx context.Context, id int64) ([]Attr, error)
+
+	// Revisions returns the revisions of a note, oldest first.
+	Revisions(ctx context.Context, id int64) ([]Revision, error)
+
+	Close() error
+}
+
+// Text returns the content of the revision
+func (rev Revision) Text() string {
+	return rev.ValueText.String
+}
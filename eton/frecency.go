@@ -0,0 +1,68 @@
+package eton
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// sqlFrecency ranks notes by how often and how recently they were accessed:
+// the number of accesses divided by 1 + the number of weeks since the last
+// access, so that a note counts half after a week without access, a third
+// after two weeks, and so on.
+const sqlFrecency = "((COALESCE(frequency, 0) + 1) / (1 + (julianday('now') - julianday(COALESCE(accessed_at, updated_at, created_at))) / 7.0))"
+
+// defaultSort is the order of ListOptions.Sort when it is empty.
+const defaultSort = "frecency"
+
+// sortOrders are the orders of ListOptions.Sort, ties are broken by the
+// modification time.
+var sortOrders = map[string]string{
+	"updated":   orderby,
+	"created":   "created_at DESC",
+	"accessed":  "accessed_at IS NULL, accessed_at DESC",
+	"frequency": "frequency DESC",
+	"frecency":  sqlFrecency + " DESC",
+	"alias":     "alias IS NULL, alias COLLATE NOCASE",
+}
+
+// SortOrders returns the names accepted by ListOptions.Sort.
+func SortOrders() []string {
+	names := make([]string, 0, len(sortOrders))
+	for name := range sortOrders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// orderByClause returns the ORDER BY clause of a sort order.
+func orderByClause(order string) (string, error) {
+	if len(order) == 0 {
+		order = defaultSort
+	}
+	clause, ok := sortOrders[order]
+	if !ok {
+		return "", fmt.Errorf("eton: unknown sort order %q, expected one of %s", order, strings.Join(SortOrders(), ", "))
+	}
+	if clause == orderby {
+		return clause, nil
+	}
+	return clause + ", " + orderby, nil
+}
+
+// SetTracking enables or disables the bookkeeping of accesses, on by
+// default. Every note returned by Get, Find, FindByAlias or Last counts as
+// an access, which increments its frequency and sets its accessed_at.
+func (s *SQLiteStore) SetTracking(enabled bool) {
+	s.untracked = !enabled
+}
+
+func (s *SQLiteStore) trackAccess(ctx context.Context, id int64) error {
+	if s.untracked {
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx, "UPDATE attributes SET frequency = frequency + 1, accessed_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", id)
+	return err
+}
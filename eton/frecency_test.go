@@ -0,0 +1,38 @@
+package eton
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestListSortsByFrecency(t *testing.T) {
+	ctx, s := openTestStore(t)
+	used := createNote(t, ctx, s, "opened often", "")
+	latest := createNote(t, ctx, s, "written last", "")
+	for i := 0; i < 3; i++ {
+		if _, err := s.Get(ctx, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for sort, want := range map[string][]int64{
+		"":         {used, latest},
+		"frecency": {used, latest},
+	} {
+		attrs, err := s.List(ctx, ListOptions{Sort: sort, Limit: -1, RootID: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int64
+		for _, attr := range attrs {
+			got = append(got, attr.ID.Int64)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("List sorted by %q = %v, want %v", sort, got, want)
+		}
+	}
+
+	if _, err := orderByClause("size"); err == nil {
+		t.Error("orderByClause(size) did not fail")
+	}
+}
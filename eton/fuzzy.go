@@ -0,0 +1,198 @@
+package eton
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ErrAmbiguous is matched by errors.Is for an *AmbiguousError.
+var ErrAmbiguous = errors.New("eton: alias is ambiguous")
+
+// AmbiguousError is returned when an alias matches several notes fuzzily,
+// none of them clearly better than the others.
+type AmbiguousError struct {
+	Alias      string
+	Candidates []AliasMatch // best first
+}
+
+func (e *AmbiguousError) Error() string {
+	aliases := make([]string, len(e.Candidates))
+	for i, candidate := range e.Candidates {
+		aliases[i] = candidate.Alias.String
+	}
+	return fmt.Sprintf("eton: %q is ambiguous, it matches %s", e.Alias, strings.Join(aliases, ", "))
+}
+
+// Is makes errors.Is(err, ErrAmbiguous) true.
+func (e *AmbiguousError) Is(target error) bool {
+	return target == ErrAmbiguous
+}
+
+// AliasMatch is a note whose alias matches a fuzzy lookup.
+type AliasMatch struct {
+	Attr
+	Score    int     // see fuzzyScore, higher is better
+	Frecency float64 // see sqlFrecency
+}
+
+// Scores of fuzzyScore. A matched character is worth scoreMatch, more if it
+// follows the previous match or starts a word, and gaps between matches
+// cost a few points.
+const (
+	scoreMatch          = 16
+	bonusConsecutive    = 8
+	bonusBoundary       = 8
+	bonusFirstChar      = 8
+	penaltyGapStart     = 3
+	penaltyGapExtension = 1
+
+	// ambiguityMargin is the difference of score under which two matches
+	// are equally good
+	ambiguityMargin = scoreMatch
+
+	// frecencyDominance is how many times more frecent than the others the
+	// best of equally good matches must be to be picked
+	frecencyDominance = 4
+)
+
+// fuzzyScore returns the score of the best alignment of the characters of
+// pattern in text, in order and ignoring case, and false if text does not
+// contain them all.
+func fuzzyScore(pattern, text string) (int, bool) {
+	p := []rune(strings.ToLower(pattern))
+	original := []rune(text)
+	t := []rune(strings.ToLower(text))
+	if len(p) == 0 || len(p) > len(t) {
+		return 0, false
+	}
+
+	const none = -1 << 30
+	// score[i][j] is the best score of p[:i+1] with p[i] matched at t[j]
+	score := make([][]int, len(p))
+	for i := range score {
+		score[i] = make([]int, len(t))
+		for j := range score[i] {
+			score[i][j] = none
+		}
+	}
+
+	for i := range p {
+		for j := i; j < len(t); j++ {
+			if t[j] != p[i] {
+				continue
+			}
+
+			bonus := 0
+			if j == 0 {
+				bonus = bonusFirstChar + bonusBoundary
+			} else if !unicode.IsLetter(original[j-1]) && !unicode.IsDigit(original[j-1]) ||
+				unicode.IsLower(original[j-1]) && unicode.IsUpper(original[j]) {
+				bonus = bonusBoundary
+			}
+
+			if i == 0 {
+				score[i][j] = scoreMatch + bonus
+				continue
+			}
+
+			best := none
+			for k := i - 1; k < j; k++ {
+				if score[i-1][k] == none {
+					continue
+				}
+				s := score[i-1][k]
+				if k == j-1 {
+					s += bonusConsecutive
+				} else {
+					s -= penaltyGapStart + (j-k-2)*penaltyGapExtension
+				}
+				if s > best {
+					best = s
+				}
+			}
+			if best != none {
+				score[i][j] = best + scoreMatch + bonus
+			}
+		}
+	}
+
+	best := none
+	for _, s := range score[len(p)-1] {
+		if s > best {
+			best = s
+		}
+	}
+	return best, best != none
+}
+
+// MatchAlias returns the notes, not removed, whose alias contains the
+// characters of alias in order, ignoring case, best match first. Equal
+// matches are ordered by frecency.
+func (s *SQLiteStore) MatchAlias(ctx context.Context, alias string) (matches []AliasMatch, err error) {
+	pattern := "%"
+	for _, r := range alias {
+		pattern += likePattern(string(r)) + "%"
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+sqlSelect+", "+sqlFrecency+" FROM attributes WHERE deleted_at IS NULL AND alias LIKE ? ESCAPE '\\'", pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var match AliasMatch
+		if err = rows.Scan(append(match.scanDest(), &match.Frecency)...); err != nil {
+			return nil, err
+		}
+		var ok bool
+		if match.Score, ok = fuzzyScore(alias, match.Alias.String); ok {
+			matches = append(matches, match)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if matches[i].Frecency != matches[j].Frecency {
+			return matches[i].Frecency > matches[j].Frecency
+		}
+		return matches[i].Alias.String < matches[j].Alias.String
+	})
+	return matches, nil
+}
+
+// PickMatch returns the best of the matches of alias returned by
+// MatchAlias. It returns ErrNotFound if there are none, or an
+// *AmbiguousError if others are within ambiguityMargin of the best. Unless
+// strict, the best is still picked if it is frecencyDominance times more
+// frecent than them.
+func PickMatch(alias string, matches []AliasMatch, strict bool) (Attr, error) {
+	if len(matches) == 0 {
+		return Attr{}, ErrNotFound
+	}
+
+	best := matches[0]
+	candidates := []AliasMatch{best}
+	dominant := true
+	for _, match := range matches[1:] {
+		if match.Score <= best.Score-ambiguityMargin {
+			break
+		}
+		candidates = append(candidates, match)
+		dominant = dominant && best.Frecency >= frecencyDominance*match.Frecency
+	}
+
+	if len(candidates) == 1 || !strict && dominant {
+		return best.Attr, nil
+	}
+	return Attr{}, &AmbiguousError{Alias: alias, Candidates: candidates}
+}
@@ -0,0 +1,103 @@
+package eton
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	for _, test := range []struct {
+		pattern, text string
+		ok            bool
+	}{
+		{"dn", "docker-notes", true},
+		{"DN", "docker-notes", true},
+		{"nd", "docker-notes", false},
+		{"", "docker-notes", false},
+		{"docker-notes!", "docker-notes", false},
+	} {
+		if _, ok := fuzzyScore(test.pattern, test.text); ok != test.ok {
+			t.Errorf("fuzzyScore(%q, %q) matches: %v, want %v", test.pattern, test.text, ok, test.ok)
+		}
+	}
+
+	// better alignments score higher
+	better := []struct{ pattern, text, worse string }{
+		{"proc", "procs", "my-p-r-o-c"},      // consecutive characters
+		{"dn", "docker-notes", "addendum"},   // word starts
+		{"dn", "dockerNotes", "dockernotes"}, // camelCase boundaries
+		{"note", "notes", "my-notes"},        // the first character
+		{"ab", "a-b", "a--------b"},          // shorter gaps
+	}
+	for _, test := range better {
+		s1, ok1 := fuzzyScore(test.pattern, test.text)
+		s2, ok2 := fuzzyScore(test.pattern, test.worse)
+		if !ok1 || !ok2 || s1 <= s2 {
+			t.Errorf("fuzzyScore(%q): %q scores %d, %q scores %d, want the first higher", test.pattern, test.text, s1, test.worse, s2)
+		}
+	}
+}
+
+func aliasMatch(alias string, score int, frecency float64) AliasMatch {
+	var match AliasMatch
+	match.Alias = sql.NullString{String: alias, Valid: true}
+	match.Score, match.Frecency = score, frecency
+	return match
+}
+
+func TestPickMatch(t *testing.T) {
+	distinct := []AliasMatch{aliasMatch("procs", 100, 1), aliasMatch("pr-oc", 100-ambiguityMargin, 1)}
+	near := []AliasMatch{aliasMatch("procs", 100, 1), aliasMatch("proc2", 99, 1)}
+	frecent := []AliasMatch{aliasMatch("procs", 100, frecencyDominance), aliasMatch("proc2", 99, 1)}
+
+	tests := []struct {
+		matches []AliasMatch
+		strict  bool
+		want    string
+		err     error
+	}{
+		{nil, false, "", ErrNotFound},
+		{distinct, true, "procs", nil},
+		{near, false, "", ErrAmbiguous},
+		{frecent, false, "procs", nil},
+		{frecent, true, "", ErrAmbiguous},
+	}
+	for i, test := range tests {
+		attr, err := PickMatch("proc", test.matches, test.strict)
+		if !errors.Is(err, test.err) || attr.Alias.String != test.want {
+			t.Errorf("%d: PickMatch = %q, %v, want %q, %v", i, attr.Alias.String, err, test.want, test.err)
+		}
+	}
+
+	var ambiguous *AmbiguousError
+	if _, err := PickMatch("proc", near, false); !errors.As(err, &ambiguous) || len(ambiguous.Candidates) != 2 {
+		t.Errorf("PickMatch = %v, want an *AmbiguousError with 2 candidates", err)
+	}
+}
+
+func TestFindByAliasFuzzy(t *testing.T) {
+	ctx, s := openTestStore(t)
+	createNote(t, ctx, s, "docker", "docker-notes")
+	createNote(t, ctx, s, "k8s", "kubernetes")
+	removed := createNote(t, ctx, s, "old", "docker-old")
+	if _, err := s.Remove(ctx, removed, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for alias, want := range map[string]string{
+		"dn":         "docker-notes",
+		"kube":       "kubernetes",
+		"docker-old": "docker-old", // exact aliases find removed notes
+	} {
+		if attr, err := s.FindByAlias(ctx, alias, false); err != nil || attr.Alias.String != want {
+			t.Errorf("FindByAlias(%q) = %q, %v, want %q", alias, attr.Alias.String, err, want)
+		}
+	}
+	if _, err := s.FindByAlias(ctx, "dold", false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByAlias(dold) = %v, fuzzy matches must skip removed notes", err)
+	}
+	if _, err := s.FindByAlias(ctx, "dn", true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByAlias(dn, exact) = %v, want ErrNotFound", err)
+	}
+}
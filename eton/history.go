@@ -0,0 +1,23 @@
+package eton
+
+import "context"
+
+// Revisions returns the revisions of a note, oldest first. Revisions are
+// recorded by triggers on the attributes table, see schemaMigrations.
+func (s *SQLiteStore) Revisions(ctx context.Context, id int64) (revs []Revision, err error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, attribute_id, value_text, created_at FROM revisions WHERE attribute_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revs = make([]Revision, 0, 0)
+	for rows.Next() {
+		rev := Revision{Number: len(revs) + 1}
+		if err = rows.Scan(&rev.ID, &rev.AttributeID, &rev.ValueText, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revs = append(revs, rev)
+	}
+	return revs, rows.Err()
+}
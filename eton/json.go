@@ -0,0 +1,102 @@
+package eton
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// attrJSON is the JSON representation of an attribute, see the "JSON
+// output" section of README.md. Fields may be added, but never renamed or
+// removed. NULL values are null, value_blob is base64 encoded.
+type attrJSON struct {
+	ID         *int64     `json:"id"`
+	ParentID   *int64     `json:"parent_id"`
+	Name       *string    `json:"name"`
+	Alias      *string    `json:"alias"`
+	Path       *string    `json:"path"`
+	Frequency  *int64     `json:"frequency"`
+	Mark       *int64     `json:"mark"`
+	Tags       []string   `json:"tags"`
+	Version    int64      `json:"version"`
+	ValueText  *string    `json:"value_text"`
+	ValueBlob  []byte     `json:"value_blob"`
+	ValueInt   *int64     `json:"value_int"`
+	ValueReal  *float64   `json:"value_real"`
+	ValueTime  *time.Time `json:"value_time"`
+	CreatedAt  *time.Time `json:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at"`
+	AccessedAt *time.Time `json:"accessed_at"`
+	DeletedAt  *time.Time `json:"deleted_at"`
+
+	FileMode       *int64     `json:"file_mode"`
+	FileModifiedAt *time.Time `json:"file_modified_at"`
+	MimeType       *string    `json:"mime_type"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (attr Attr) MarshalJSON() ([]byte, error) {
+	tags := attr.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	var valueTime *time.Time
+	if !attr.ValueTime.IsZero() {
+		valueTime = &attr.ValueTime
+	}
+
+	return json.Marshal(attrJSON{
+		ID:         jsonInt(attr.ID),
+		ParentID:   jsonInt(attr.ParentID),
+		Name:       jsonString(attr.Name),
+		Alias:      jsonString(attr.Alias),
+		Path:       jsonString(attr.Path),
+		Frequency:  jsonInt(attr.Frequency),
+		Mark:       jsonInt(attr.Mark),
+		Tags:       tags,
+		Version:    attr.Version,
+		ValueText:  jsonString(attr.ValueText),
+		ValueBlob:  attr.ValueBlob,
+		ValueInt:   jsonInt(attr.ValueInt),
+		ValueReal:  jsonFloat(attr.ValueReal),
+		ValueTime:  valueTime,
+		CreatedAt:  jsonTime(attr.CreatedAt),
+		UpdatedAt:  jsonTime(attr.UpdatedAt),
+		AccessedAt: jsonTime(attr.AccessedAt),
+		DeletedAt:  jsonTime(attr.DeletedAt),
+
+		FileMode:       jsonInt(attr.FileMode),
+		FileModifiedAt: jsonTime(attr.FileModifiedAt),
+		MimeType:       jsonString(attr.MimeType),
+	})
+}
+
+func jsonInt(i sql.NullInt64) *int64 {
+	if !i.Valid {
+		return nil
+	}
+	return &i.Int64
+}
+
+func jsonFloat(f sql.NullFloat64) *float64 {
+	if !f.Valid {
+		return nil
+	}
+	return &f.Float64
+}
+
+func jsonString(str sql.NullString) *string {
+	if !str.Valid {
+		return nil
+	}
+	return &str.String
+}
+
+func jsonTime(t NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
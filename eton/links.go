@@ -0,0 +1,108 @@
+package eton
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// linkRegexp matches [[alias]] and [[123]]
+var linkRegexp = regexp.MustCompile(`\[\[([^\[\]\n]+)\]\]`)
+
+// ParseLinks returns the unique link texts in text, in order of appearance.
+func ParseLinks(text string) (links []string) {
+	seen := make(map[string]bool)
+	for _, match := range linkRegexp.FindAllStringSubmatch(text, -1) {
+		link := strings.TrimSpace(match[1])
+		if len(link) > 0 && !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// syncLinks replaces the outgoing links of a note with the [[links]] in
+// valueText. Links that do not resolve yet are kept with a NULL target_id,
+// they are resolved when a note gets that alias.
+func (s *SQLiteStore) syncLinks(ctx context.Context, id int64, valueText string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM links WHERE source_id = ?", id); err != nil {
+		return err
+	}
+
+	stmt, err := s.db.PrepareContext(ctx, "INSERT INTO links (source_id, target_id, text) VALUES (?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, link := range ParseLinks(valueText) {
+		var targetID interface{}
+		target, err := s.resolveLink(ctx, link)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if err == nil && target.ID.Int64 != id {
+			targetID = target.ID.Int64
+		}
+		if _, err = stmt.ExecContext(ctx, id, targetID, link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveLink returns the note a link points to, by exact alias or else by
+// ID. Unlike Find, it does not match aliases fuzzily: a link must keep its
+// target when other notes are added, and renameLinks only rewrites the
+// links that name the alias exactly. Resolving a link is not an access.
+func (s *SQLiteStore) resolveLink(ctx context.Context, link string) (Attr, error) {
+	attr, err := s.findByAlias(ctx, link, true)
+	if !errors.Is(err, ErrNotFound) {
+		return attr, err
+	}
+	id, err := strconv.ParseInt(link, 10, 64)
+	if err != nil {
+		return Attr{}, ErrNotFound
+	}
+	return s.get(ctx, id)
+}
+
+// Backlinks returns the notes linking to a note.
+func (s *SQLiteStore) Backlinks(ctx context.Context, id int64) ([]Attr, error) {
+	return s.queryAttrs(ctx, "SELECT "+sqlSelect+" FROM attributes WHERE deleted_at IS NULL AND id IN (SELECT source_id FROM links WHERE target_id = ?) ORDER BY "+orderby, id)
+}
+
+// renameLinks rewrites [[oldText]] to [[newText]] in the notes linking to a
+// note, and resolves the dangling links to newText.
+func (s *SQLiteStore) renameLinks(ctx context.Context, id int64, oldText, newText string) (rowsAffected int64, err error) {
+	if len(oldText) > 0 {
+		sources, err := s.Backlinks(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+
+		re := regexp.MustCompile(`\[\[\s*` + regexp.QuoteMeta(oldText) + `\s*\]\]`)
+		for _, source := range sources {
+			valueText := source.ValueText.String
+			if newValueText := re.ReplaceAllLiteralString(valueText, "[["+newText+"]]"); newValueText != valueText {
+				n, err := s.Update(ctx, source.ID.Int64, newValueText)
+				if err != nil {
+					return rowsAffected, err
+				}
+				rowsAffected += n
+			}
+		}
+	}
+
+	_, err = s.db.ExecContext(ctx, "UPDATE links SET target_id = ? WHERE target_id IS NULL AND text = ? AND source_id != ?", id, newText, id)
+	return rowsAffected, err
+}
+
+// sqlNullInt64 returns NULL for -1
+func sqlNullInt64(i int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: i, Valid: i != -1}
+}
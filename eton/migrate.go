@@ -0,0 +1,214 @@
+package eton
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// schemaMigrations upgrade the database one version at a time:
+// schemaMigrations[i] takes a database from version i to version i+1.
+// The version is stored in "PRAGMA user_version".
+//
+// Released migrations must never be edited, append a new one instead.
+var schemaMigrations = []string{
+	// 1: initial schema, databases created before versioning already have it
+	`
+	CREATE TABLE IF NOT EXISTS attributes (
+		id          INTEGER NOT NULL PRIMARY KEY,
+		name        TEXT,
+		alias       TEXT,
+		parent_id   INTEGER,
+		frequency   INTEGER DEFAULT 0,
+		mark        INTEGER DEFAULT 0,
+
+		value_text  TEXT,
+		value_blob  BLOB,
+		value_int   INTEGER,
+		value_real  REAL,
+		value_time  DATETIME,
+
+		accessed_at DATETIME,
+		updated_at  DATETIME,
+		deleted_at  DATETIME,
+		created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS index_on_alias        ON attributes (alias);
+	CREATE        INDEX IF NOT EXISTS index_on_name         ON attributes (name);
+	CREATE        INDEX IF NOT EXISTS index_on_value_text   ON attributes (value_text);
+	CREATE        INDEX IF NOT EXISTS index_on_value_blob   ON attributes (value_blob);
+	CREATE        INDEX IF NOT EXISTS index_on_value_int    ON attributes (value_int);
+	CREATE        INDEX IF NOT EXISTS index_on_value_real   ON attributes (value_real);
+	CREATE        INDEX IF NOT EXISTS index_on_accessed_at  ON attributes (accessed_at);
+	CREATE        INDEX IF NOT EXISTS index_on_deleted_at   ON attributes (deleted_at);
+	CREATE        INDEX IF NOT EXISTS index_on_frequency    ON attributes (frequency);
+	CREATE        INDEX IF NOT EXISTS index_on_mark         ON attributes (mark);
+	`,
+
+	// 2: note history, the current content of every note is its first revision
+	`
+	CREATE TABLE revisions (
+		id           INTEGER NOT NULL PRIMARY KEY,
+		attribute_id INTEGER NOT NULL,
+		value_text   TEXT,
+		created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX index_on_revisions_attribute_id ON revisions (attribute_id);
+
+	INSERT INTO revisions (attribute_id, value_text, created_at)
+		SELECT id, value_text, COALESCE(updated_at, created_at) FROM attributes
+		WHERE value_text IS NOT NULL AND value_blob IS NULL
+		ORDER BY id;
+
+	CREATE TRIGGER revisions_insert AFTER INSERT ON attributes
+	WHEN new.value_text IS NOT NULL AND new.value_blob IS NULL BEGIN
+		INSERT INTO revisions (attribute_id, value_text) VALUES (new.id, new.value_text);
+	END;
+
+	-- editors may save the same content several times, only record changes
+	CREATE TRIGGER revisions_update AFTER UPDATE OF value_text ON attributes
+	WHEN new.value_text IS NOT old.value_text AND new.value_blob IS NULL BEGIN
+		INSERT INTO revisions (attribute_id, value_text) VALUES (new.id, new.value_text);
+	END;
+	`,
+
+	// 3: tags, from_body is 1 for #tags parsed from the note's content
+	`
+	CREATE TABLE tags (
+		attribute_id INTEGER NOT NULL,
+		tag          TEXT NOT NULL,
+		from_body    INTEGER NOT NULL DEFAULT 0,
+		created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (attribute_id, tag)
+	);
+
+	CREATE INDEX index_on_tags_tag ON tags (tag);
+	`,
+
+	// 4: [[links]] between notes, target_id is NULL until the link resolves
+	`
+	CREATE TABLE links (
+		source_id INTEGER NOT NULL,
+		target_id INTEGER,
+		text      TEXT NOT NULL,
+		PRIMARY KEY (source_id, text)
+	);
+
+	CREATE INDEX index_on_links_target_id ON links (target_id);
+	`,
+
+	// 5: version counts the changes to the content of a note, for optimistic
+	// locking, see Store.UpdateIfVersion
+	`
+	ALTER TABLE attributes ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+	CREATE TRIGGER attributes_version AFTER UPDATE OF value_text, value_blob ON attributes
+	WHEN new.version = old.version BEGIN
+		UPDATE attributes SET version = old.version + 1 WHERE id = new.id;
+	END;
+	`,
+
+	// 6: permission bits and modification time of files added with AddFile
+	`
+	ALTER TABLE attributes ADD COLUMN file_mode INTEGER;
+	ALTER TABLE attributes ADD COLUMN file_modified_at DATETIME;
+	`,
+
+	// 7: MIME type of files added with AddFile, NULL for the files added before
+	`
+	ALTER TABLE attributes ADD COLUMN mime_type TEXT;
+	`,
+
+	// 8: saving a note without changing it keeps its version
+	`
+	DROP TRIGGER attributes_version;
+
+	CREATE TRIGGER attributes_version AFTER UPDATE OF value_text, value_blob ON attributes
+	WHEN new.version = old.version
+		AND (new.value_text IS NOT old.value_text OR new.value_blob IS NOT old.value_blob) BEGIN
+		UPDATE attributes SET version = old.version + 1 WHERE id = new.id;
+	END;
+	`,
+
+	// 9: queue the changed notes for the full-text index, which only builds
+	// with FTS5 keep up to date. The triggers of the index itself would make
+	// every write fail in the other builds.
+	`
+	CREATE TABLE fulltext_changes (
+		id INTEGER NOT NULL PRIMARY KEY
+	);
+
+	CREATE TRIGGER fulltext_changes_insert AFTER INSERT ON attributes BEGIN
+		INSERT OR IGNORE INTO fulltext_changes (id) VALUES (new.id);
+	END;
+
+	CREATE TRIGGER fulltext_changes_update AFTER UPDATE OF value_text, alias ON attributes BEGIN
+		INSERT OR IGNORE INTO fulltext_changes (id) VALUES (new.id);
+	END;
+
+	CREATE TRIGGER fulltext_changes_delete AFTER DELETE ON attributes BEGIN
+		INSERT OR IGNORE INTO fulltext_changes (id) VALUES (old.id);
+	END;
+
+	DROP TRIGGER IF EXISTS attributes_fts_insert;
+	DROP TRIGGER IF EXISTS attributes_fts_delete;
+	DROP TRIGGER IF EXISTS attributes_fts_update;
+
+	INSERT INTO fulltext_changes (id) SELECT id FROM attributes;
+	`,
+}
+
+// schemaVersion returns the version of the database schema.
+func schemaVersion(ctx context.Context, db *sql.DB) (version int, err error) {
+	err = db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// migrate applies the pending migrations, each one in its own transaction.
+// It refuses to touch a database created by a newer eton. The transactions
+// are IMMEDIATE and read the version again, so that two processes opening
+// the same database do not both apply a migration.
+func migrate(ctx context.Context, db *sql.DB) (applied int, err error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	for {
+		if _, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+			return applied, err
+		}
+
+		var version int
+		if err = conn.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err == nil {
+			switch {
+			case version > len(schemaMigrations):
+				err = fmt.Errorf("%w: schema version %d, latest supported version %d", ErrSchemaTooNew, version, len(schemaMigrations))
+			case version == len(schemaMigrations):
+				_, err = conn.ExecContext(ctx, "COMMIT")
+				return applied, err
+			default:
+				if _, err = conn.ExecContext(ctx, schemaMigrations[version]); err == nil {
+					// PRAGMA does not accept parameters
+					_, err = conn.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version+1))
+				}
+				if err != nil {
+					err = fmt.Errorf("migrating database to version %d: %w", version+1, err)
+				}
+			}
+		}
+
+		if err != nil {
+			conn.ExecContext(context.Background(), "ROLLBACK")
+			return applied, err
+		}
+
+		if _, err = conn.ExecContext(ctx, "COMMIT"); err != nil {
+			return applied, err
+		}
+		applied++
+	}
+}
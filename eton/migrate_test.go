@@ -0,0 +1,129 @@
+package eton
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMigrateNewDatabase(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "eton.db")
+
+	s, err := Open(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := s.SchemaVersion(ctx)
+	if err != nil || version != len(schemaMigrations) || s.Migrated() != len(schemaMigrations) {
+		t.Errorf("new database at version %d after %d migrations, %v, want %d", version, s.Migrated(), err, len(schemaMigrations))
+	}
+	s.Close()
+
+	if s, err = Open(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Migrated() != 0 {
+		t.Errorf("reopening applied %d migrations, want none", s.Migrated())
+	}
+}
+
+func TestMigrateUnversionedDatabase(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "eton.db")
+
+	// a database created before the schema was versioned
+	db, err := sql.Open(driverName, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(schemaMigrations[0] + "INSERT INTO attributes (name, alias, value_text) VALUES ('note', 'old', 'written long ago');")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	attr, err := s.FindByAlias(ctx, "old", true)
+	if err != nil || attr.Version != 1 || attr.ValueText.String != "written long ago" {
+		t.Fatalf("migrated note = %+v, %v", attr, err)
+	}
+	revisions, err := s.Revisions(ctx, attr.ID.Int64)
+	if err != nil || len(revisions) != 1 {
+		t.Errorf("migrated note has %d revisions, %v, want its content as the first", len(revisions), err)
+	}
+
+	// saving the same content keeps the version
+	version, err := s.UpdateIfVersion(ctx, attr.ID.Int64, "written long ago", attr.Version)
+	if err != nil || version != attr.Version {
+		t.Errorf("saving the same content = version %d, %v, want %d", version, err, attr.Version)
+	}
+	if version, err = s.UpdateIfVersion(ctx, attr.ID.Int64, "rewritten", attr.Version); err != nil || version != attr.Version+1 {
+		t.Errorf("saving a change = version %d, %v, want %d", version, err, attr.Version+1)
+	}
+}
+
+func TestMigrateNewerDatabase(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "eton.db")
+
+	db, err := sql.Open(driverName, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(schemaMigrations)+1))
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := Open(ctx, path); !errors.Is(err, ErrSchemaTooNew) {
+		if err == nil {
+			s.Close()
+		}
+		t.Errorf("opening a newer database = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestMigrateConcurrently(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "eton.db")
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	migrated := make([]int, len(errs))
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s, err := Open(ctx, path)
+			if err == nil {
+				migrated[i] = s.Migrated()
+				s.Close()
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Open %d: %v", i, err)
+		}
+		total += migrated[i]
+	}
+	if total != len(schemaMigrations) {
+		t.Errorf("%d migrations applied in total, want each one once, %d", total, len(schemaMigrations))
+	}
+}
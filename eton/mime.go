@@ -0,0 +1,41 @@
+package eton
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// DetectMimeType returns the MIME type of a file, sniffed from its content
+// with the algorithm of http.DetectContentType, or guessed from the
+// extension of path if the content is not recognized.
+func DetectMimeType(path string, content []byte) string {
+	mimeType := http.DetectContentType(content)
+	if mimeType == "application/octet-stream" {
+		if byExtension := mime.TypeByExtension(filepath.Ext(path)); len(byExtension) > 0 {
+			return byExtension
+		}
+	}
+	return mimeType
+}
+
+// IsTextMimeType reports whether files of a MIME type are text, that can be
+// printed to a terminal.
+func IsTextMimeType(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-sh", "image/svg+xml":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,533 @@
+package eton
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// List filters are joined into a query:
+//
+//	docker k8s              notes containing both words, a word is a prefix
+//	"exact phrase"          a phrase, also used to search for AND, OR, NOT
+//	docker OR k8s           either word
+//	NOT docker              notes without the word
+//	(a OR b) AND c          AND is implied between terms
+//	+tag -tag tag:name      notes with or without a tag
+//	alias:proc* name:file   alias or name, * matches any characters
+//	marked                  marked notes
+//	id:>100                 compare the ID
+//	created:>2026-01-01     created after that day, also updated: and accessed:
+//	updated:<7d             updated less than 7 days ago, units are h, d, w, y
+//
+// NOT binds tighter than AND, which binds tighter than OR. Dates and ages
+// accept the operators >, >=, <, <= and =, which is the default.
+
+// QueryError is returned by List when its filters are not a valid query.
+type QueryError struct {
+	Query string
+	Pos   int // byte offset of the failing token in Query
+	Len   int
+	Msg   string
+}
+
+func (e *QueryError) Error() string {
+	width := utf8.RuneCountInString(e.Query[e.Pos : e.Pos+e.Len])
+	if width == 0 {
+		width = 1
+	}
+	indent := strings.Repeat(" ", utf8.RuneCountInString(e.Query[:e.Pos]))
+	return fmt.Sprintf("invalid query: %s\n    %s\n    %s%s", e.Msg, e.Query, indent, strings.Repeat("^", width))
+}
+
+// Query is a parsed list of filters.
+type Query struct {
+	root queryNode // nil if there are no filters
+}
+
+type queryNode interface{}
+
+type (
+	queryAnd []queryNode
+	queryOr  []queryNode
+	queryNot struct{ node queryNode }
+)
+
+// queryTerm is a word of the query other than a keyword or a parenthesis.
+// Text terms, with an empty field, are compiled by the store, because they
+// depend on the full-text index. The others are compiled when parsed.
+type queryTerm struct {
+	field  string
+	value  string
+	phrase bool
+
+	sql  string
+	args []interface{}
+}
+
+type queryToken struct {
+	text string // "" at the end of the query
+	pos  int
+}
+
+var queryFieldPattern = regexp.MustCompile(`^(tag|alias|name|id|created|updated|accessed):.`)
+
+var queryTimeColumns = map[string]string{
+	"created":  "created_at",
+	"updated":  sqlModifiedAt,
+	"accessed": "accessed_at",
+}
+
+// ParseQuery parses the filters of a list, see ListOptions. The filters are
+// joined and split again into words, so 'docker OR k8s' is one argument or
+// three; only quoted text is a phrase.
+func ParseQuery(filters []string) (*Query, error) {
+	return parseQuery(strings.Join(filters, " "), time.Now())
+}
+
+func isPhrase(word string) bool {
+	return len(word) > 1 && strings.HasPrefix(word, `"`) && strings.HasSuffix(word, `"`)
+}
+
+func parseQuery(text string, now time.Time) (*Query, error) {
+	tokens, err := lexQuery(text)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{}
+	if len(tokens) == 1 {
+		return q, nil
+	}
+
+	p := queryParser{query: text, tokens: tokens, now: now}
+	if q.root, err = p.parseOr(); err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.text != "" {
+		return nil, p.errorAt(tok, "unexpected %s", tok.text)
+	}
+	return q, nil
+}
+
+// lexQuery splits a query into words and parentheses. A word may contain
+// quoted parts with spaces, e.g. name:"my file".
+func lexQuery(text string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case ' ', '\t', '\n':
+			i++
+		case '(', ')':
+			tokens = append(tokens, queryToken{text[i : i+1], i})
+			i++
+		default:
+			start := i
+			for i < len(text) && !strings.ContainsRune(" \t\n()", rune(text[i])) {
+				if text[i] == '"' {
+					end := strings.IndexByte(text[i+1:], '"')
+					if end == -1 {
+						return nil, &QueryError{text, i, len(text) - i, "unterminated quote"}
+					}
+					i += end + 1
+				}
+				i++
+			}
+			tokens = append(tokens, queryToken{text[start:i], start})
+		}
+	}
+	return append(tokens, queryToken{"", len(text)}), nil
+}
+
+type queryParser struct {
+	query  string
+	tokens []queryToken
+	next   int
+	now    time.Time
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) isKeyword(keyword string) bool {
+	return p.peek().text == keyword
+}
+
+func (p *queryParser) errorAt(tok queryToken, format string, a ...interface{}) error {
+	return &QueryError{p.query, tok.pos, len(tok.text), fmt.Sprintf(format, a...)}
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	var nodes queryOr
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+		if !p.isKeyword("OR") {
+			break
+		}
+		p.next++
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var nodes queryAnd
+	for {
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+
+		if p.isKeyword("AND") {
+			p.next++
+			continue
+		}
+		if tok := p.peek(); tok.text == "" || tok.text == ")" || tok.text == "OR" {
+			break
+		}
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	if !p.isKeyword("NOT") {
+		return p.parsePrimary()
+	}
+	p.next++
+	node, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return queryNot{node}, nil
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	tok := p.peek()
+	switch tok.text {
+	case "":
+		return nil, p.errorAt(tok, "unexpected end of query, expected a term")
+	case ")", "AND", "OR":
+		return nil, p.errorAt(tok, "unexpected %s, expected a term", tok.text)
+	case "(":
+		p.next++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isKeyword(")") {
+			return nil, p.errorAt(tok, "unclosed parenthesis")
+		}
+		p.next++
+		return node, nil
+	}
+
+	p.next++
+	return p.parseTerm(tok)
+}
+
+func (p *queryParser) parseTerm(tok queryToken) (queryNode, error) {
+	word := tok.text
+
+	if word == "marked" {
+		return &queryTerm{field: word, sql: "mark > 0"}, nil
+	}
+
+	if IsTagFilter(word) {
+		term := &queryTerm{field: "tag", value: NormalizeTag(word[1:])}
+		term.sql, term.args = "id IN (SELECT attribute_id FROM tags WHERE tag = ?)", []interface{}{term.value}
+		if word[0] == '-' {
+			return queryNot{term}, nil
+		}
+		return term, nil
+	}
+
+	// other words with a colon, e.g. http://x, are searched for
+	if !queryFieldPattern.MatchString(word) {
+		if isPhrase(word) {
+			return &queryTerm{value: word[1 : len(word)-1], phrase: true}, nil
+		}
+		return &queryTerm{value: word}, nil
+	}
+
+	sep := strings.Index(word, ":")
+	term := &queryTerm{field: word[:sep], value: word[sep+1:]}
+	if isPhrase(term.value) {
+		term.value = term.value[1 : len(term.value)-1]
+	}
+
+	switch term.field {
+	case "tag":
+		tag := NormalizeTag(term.value)
+		if len(tag) == 0 {
+			return nil, p.errorAt(tok, "invalid tag %q", term.value)
+		}
+		term.sql, term.args = "id IN (SELECT attribute_id FROM tags WHERE tag = ?)", []interface{}{tag}
+	case "alias", "name":
+		term.sql, term.args = term.field+` LIKE ? ESCAPE '\'`, []interface{}{likePattern(term.value)}
+	case "id":
+		op, value := splitOperator(term.value)
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, p.errorAt(tok, "invalid id %q, expected a number", value)
+		}
+		term.sql, term.args = "id "+op+" ?", []interface{}{id}
+	case "created", "updated", "accessed":
+		if err := p.compileTime(term); err != nil {
+			return nil, p.errorAt(tok, "%v", err)
+		}
+	}
+	return term, nil
+}
+
+// compileTime compiles created:, updated: and accessed: terms, see
+// ParseTimeBounds.
+func (p *queryParser) compileTime(term *queryTerm) error {
+	since, until, err := ParseTimeBounds(term.value, p.now)
+	if err != nil {
+		_, value := splitOperator(term.value)
+		return fmt.Errorf("invalid %s date %q, expected e.g. 2026-01-31, \"2026-01-31 15:04\" or an age such as 3d or 2w", term.field, value)
+	}
+	term.sql, term.args = timeCondition(queryTimeColumns[term.field], since, until)
+	return nil
+}
+
+// ParseTimeBounds parses the value of a created:, updated: or accessed:
+// filter into the period [since, until) it selects, a zero bound is open.
+// The value is a date, compared to the whole day unless it has a time, or
+// an age, after one of the operators >, >=, <, <= and =, the default.
+func ParseTimeBounds(value string, now time.Time) (since, until time.Time, err error) {
+	op, value := splitOperator(value)
+
+	if age, err := ParseAge(value); err == nil {
+		// an age is compared the other way around: <7d is after 7 days ago
+		switch op {
+		case "<", "<=", "=":
+			return now.Add(-age), until, nil
+		default:
+			return since, now.Add(-age), nil
+		}
+	}
+
+	start, precision, err := parseDate(value)
+	if err != nil {
+		return since, until, err
+	}
+	end := start.Add(precision)
+
+	switch op {
+	case ">":
+		return end, until, nil
+	case ">=":
+		return start, until, nil
+	case "<":
+		return since, start, nil
+	case "<=":
+		return since, end, nil
+	}
+	return start, end, nil
+}
+
+// timeCondition returns the SQL condition that column is in [since, until),
+// a zero bound is open.
+func timeCondition(column string, since, until time.Time) (sql string, args []interface{}) {
+	var conditions []string
+	if !since.IsZero() {
+		conditions = append(conditions, "datetime("+column+") >= datetime(?)")
+		args = append(args, since.UTC().Format(sqlTimeLayout))
+	}
+	if !until.IsZero() {
+		conditions = append(conditions, "datetime("+column+") < datetime(?)")
+		args = append(args, until.UTC().Format(sqlTimeLayout))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// ParseTimeRange parses a date, e.g. 2026-01-31 or "2026-01-31 15:04", or
+// an age before now, e.g. 3d or 2w, with the units h, d, w and y. A date
+// names the period [from, to), a day if it has no time, an age names the
+// instant from = to.
+func ParseTimeRange(value string, now time.Time) (from, to time.Time, err error) {
+	if age, err := ParseAge(value); err == nil {
+		return now.Add(-age), now.Add(-age), nil
+	}
+	start, precision, err := parseDate(value)
+	if err != nil {
+		return from, to, fmt.Errorf("invalid date %q, expected e.g. 2026-01-31, \"2026-01-31 15:04\" or an age such as 3d or 2w", value)
+	}
+	return start, start.Add(precision), nil
+}
+
+// sqlTimeLayout is the layout of CURRENT_TIMESTAMP
+const sqlTimeLayout = "2006-01-02 15:04:05"
+
+// splitOperator splits a comparison operator from the start of value, "="
+// if there is none.
+func splitOperator(value string) (op, rest string) {
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, op) {
+			return op, value[len(op):]
+		}
+	}
+	return "=", value
+}
+
+var ageUnits = map[byte]time.Duration{
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'y': 365 * 24 * time.Hour,
+}
+
+// ParseAge parses an age, a number followed by a unit of ageUnits, e.g. 3d.
+func ParseAge(value string) (time.Duration, error) {
+	if len(value) < 2 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	unit, ok := ageUnits[value[len(value)-1]]
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+var dateLayouts = []struct {
+	layout    string
+	precision time.Duration
+}{
+	{"2006-01-02", 24 * time.Hour},
+	{"2006-01-02 15:04", time.Minute},
+	{"2006-01-02T15:04", time.Minute},
+	{"2006-01-02 15:04:05", time.Second},
+	{"2006-01-02T15:04:05", time.Second},
+}
+
+// parseDate parses a date in local time, precision is the duration of the
+// period it names, e.g. a day if it has no time.
+func parseDate(value string) (date time.Time, precision time.Duration, err error) {
+	for _, layout := range dateLayouts {
+		if date, err = time.ParseInLocation(layout.layout, value, time.Local); err == nil {
+			return date, layout.precision, nil
+		}
+	}
+	return date, 0, err
+}
+
+// likePattern translates a pattern where * matches any characters to LIKE.
+func likePattern(pattern string) string {
+	pattern = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(pattern)
+	return strings.Replace(pattern, "*", "%", -1)
+}
+
+// Empty reports whether the query has no terms.
+func (q *Query) Empty() bool {
+	return q.root == nil
+}
+
+// Highlights returns the words and phrases searched for, without the ones
+// under a NOT.
+func (q *Query) Highlights() []string {
+	var words []string
+	var walk func(node queryNode)
+	walk = func(node queryNode) {
+		switch node := node.(type) {
+		case queryAnd:
+			for _, child := range node {
+				walk(child)
+			}
+		case queryOr:
+			for _, child := range node {
+				walk(child)
+			}
+		case *queryTerm:
+			if len(node.field) == 0 {
+				words = append(words, strings.TrimSuffix(node.value, "*"))
+			}
+		}
+	}
+	walk(q.root)
+	return words
+}
+
+// fullTextFilter returns a text term in the syntax of fullTextQuery.
+func (term *queryTerm) fullTextFilter() string {
+	if term.phrase {
+		return `"` + term.value + `"`
+	}
+	return term.value
+}
+
+// compileQuery returns the SQL condition of a query and its arguments. The
+// words required at the top level are returned in rank instead when the
+// full-text index is available, they are matched by a join that ranks the
+// results.
+func (s *SQLiteStore) compileQuery(q *Query) (where string, args []interface{}, rank []string) {
+	conjuncts := []queryNode{q.root}
+	if and, ok := q.root.(queryAnd); ok {
+		conjuncts = and
+	}
+
+	conditions := make([]string, 0, len(conjuncts))
+	for _, node := range conjuncts {
+		if term, ok := node.(*queryTerm); ok && len(term.field) == 0 && s.isFullTextFilter(term.value) {
+			rank = append(rank, term.fullTextFilter())
+			continue
+		}
+		conditions = append(conditions, s.compileNode(node, &args))
+	}
+	return strings.Join(conditions, " AND "), args, rank
+}
+
+func (s *SQLiteStore) compileNode(node queryNode, args *[]interface{}) string {
+	switch node := node.(type) {
+	case queryAnd:
+		return s.compileNodes(node, " AND ", args)
+	case queryOr:
+		return s.compileNodes(node, " OR ", args)
+	case queryNot:
+		// a condition on a NULL column is NULL, and so is its negation
+		return "(" + s.compileNode(node.node, args) + " IS NOT 1)"
+	case *queryTerm:
+		if len(node.field) > 0 {
+			*args = append(*args, node.args...)
+			return "(" + node.sql + ")"
+		}
+		if s.isFullTextFilter(node.value) {
+			*args = append(*args, fullTextQuery([]string{node.fullTextFilter()}))
+			return "(id IN (SELECT rowid FROM attributes_fts WHERE attributes_fts MATCH ?))"
+		}
+		if hasWords(node.value) {
+			pattern := wordPattern(strings.TrimSuffix(node.value, "*"), node.phrase)
+			*args = append(*args, pattern, pattern)
+			return "(COALESCE(value_text, '') REGEXP ? OR COALESCE(alias, '') REGEXP ?)"
+		}
+		likeValue := "%" + likePattern(strings.TrimSuffix(node.value, "*")) + "%"
+		*args = append(*args, likeValue, likeValue)
+		return `(value_text LIKE ? ESCAPE '\' OR alias LIKE ? ESCAPE '\')`
+	}
+	panic(fmt.Sprintf("eton: unknown query node %T", node))
+}
+
+func (s *SQLiteStore) compileNodes(nodes []queryNode, sep string, args *[]interface{}) string {
+	conditions := make([]string, len(nodes))
+	for i, node := range nodes {
+		conditions[i] = s.compileNode(node, args)
+	}
+	return "(" + strings.Join(conditions, sep) + ")"
+}
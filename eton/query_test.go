@@ -0,0 +1,260 @@
+package eton
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestStore opens an empty database in a temporary directory.
+func openTestStore(t *testing.T) (context.Context, *SQLiteStore) {
+	t.Helper()
+	ctx := context.Background()
+	s, err := Open(ctx, filepath.Join(t.TempDir(), "eton.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return ctx, s
+}
+
+// createNote creates a top-level note, with an alias unless it is empty.
+func createNote(t *testing.T, ctx context.Context, s *SQLiteStore, text, alias string) int64 {
+	t.Helper()
+	id, err := s.CreateNote(ctx, text, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alias) > 0 {
+		if _, err = s.SetAlias(ctx, id, alias); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id
+}
+
+// formatNode writes a parsed query with explicit parentheses.
+func formatNode(node queryNode) string {
+	join := func(nodes []queryNode, sep string) string {
+		parts := make([]string, len(nodes))
+		for i, node := range nodes {
+			parts[i] = formatNode(node)
+		}
+		return "(" + strings.Join(parts, sep) + ")"
+	}
+
+	switch node := node.(type) {
+	case queryAnd:
+		return join(node, " AND ")
+	case queryOr:
+		return join(node, " OR ")
+	case queryNot:
+		return "NOT " + formatNode(node.node)
+	case *queryTerm:
+		text := node.value
+		if node.phrase {
+			text = `"` + text + `"`
+		}
+		if len(node.field) > 0 {
+			text = node.field + ":" + text
+		}
+		return text
+	}
+	return "?"
+}
+
+func TestLexQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", nil},
+		{"docker k8s", []string{"docker", "k8s"}},
+		{"(a OR b)", []string{"(", "a", "OR", "b", ")"}},
+		{`"two words" x`, []string{`"two words"`, "x"}},
+		{`name:"my file"`, []string{`name:"my file"`}},
+		{"  a\tb\nc ", []string{"a", "b", "c"}},
+	}
+	for _, test := range tests {
+		tokens, err := lexQuery(test.query)
+		if err != nil {
+			t.Errorf("lexQuery(%q): %v", test.query, err)
+			continue
+		}
+		var got []string
+		for _, tok := range tokens[:len(tokens)-1] {
+			got = append(got, tok.text)
+		}
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("lexQuery(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+
+	var queryErr *QueryError
+	if _, err := lexQuery(`a "open`); !errors.As(err, &queryErr) || queryErr.Pos != 2 {
+		t.Errorf("lexQuery with an unterminated quote = %v, want a QueryError at 2", err)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		filters []string
+		want    string
+	}{
+		{[]string{"docker", "k8s"}, "(docker AND k8s)"},
+		{[]string{"docker OR k8s"}, "(docker OR k8s)"},
+		{[]string{"a", "OR", "b", "c"}, "(a OR (b AND c))"},
+		{[]string{"a OR b AND c"}, "(a OR (b AND c))"},
+		{[]string{"(a OR b) c"}, "((a OR b) AND c)"},
+		{[]string{"NOT a b"}, "(NOT a AND b)"},
+		{[]string{"NOT NOT a"}, "NOT NOT a"},
+		{[]string{"NOT (a OR b)"}, "NOT (a OR b)"},
+		{[]string{`"a OR b"`}, `"a OR b"`},
+		{[]string{"two words"}, "(two AND words)"},
+		{[]string{"+work", "-home"}, "(tag:work AND NOT tag:home)"},
+		{[]string{"alias:proc*", `name:"my file"`}, "(alias:proc* AND name:my file)"},
+		{[]string{"marked"}, "marked:"},
+		{[]string{"http://x", "foo:bar"}, "(http://x AND foo:bar)"},
+		{[]string{`"name:"`}, `"name:"`},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.filters)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", test.filters, err)
+			continue
+		}
+		if got := formatNode(q.root); got != test.want {
+			t.Errorf("ParseQuery(%q) = %s, want %s", test.filters, got, test.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{"a OR", 4},
+		{"(a", 0},
+		{"a )", 2},
+		{"AND a", 0},
+		{"id:x", 0},
+		{"created:yesterday", 0},
+		{"tag:#", 0},
+	}
+	for _, test := range tests {
+		_, err := parseQuery(test.query, time.Now())
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("parseQuery(%q) = %v, want a QueryError", test.query, err)
+			continue
+		}
+		if queryErr.Pos != test.pos {
+			t.Errorf("parseQuery(%q) fails at %d, want %d", test.query, queryErr.Pos, test.pos)
+		}
+	}
+}
+
+func TestListQuery(t *testing.T) {
+	ctx, s := openTestStore(t)
+	createNote(t, ctx, s, "docker run", "")
+	createNote(t, ctx, s, "k8s apply", "")
+	createNote(t, ctx, s, "docker compose", "compose")
+	createNote(t, ctx, s, "exact phrase here", "")
+	if _, err := s.SetMark(ctx, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		filters []string
+		want    []int64
+	}{
+		{[]string{"docker"}, []int64{1, 3}},
+		{[]string{"docker OR k8s"}, []int64{1, 2, 3}},
+		{[]string{"docker", "NOT", "compose"}, []int64{1}},
+		// notes without an alias, whose alias conditions are NULL
+		{[]string{"NOT docker"}, []int64{2, 4}},
+		{[]string{"NOT zzz"}, []int64{1, 2, 3, 4}},
+		{[]string{"NOT alias:compose"}, []int64{1, 2, 4}},
+		{[]string{"NOT alias:*"}, []int64{1, 2, 4}},
+		{[]string{"NOT marked"}, []int64{1, 3, 4}},
+		{[]string{"NOT (docker OR marked)"}, []int64{4}},
+		{[]string{`"exact phrase"`}, []int64{4}},
+		{[]string{`"phrase exact"`}, nil},
+		{[]string{"id:>2"}, []int64{3, 4}},
+	}
+	for _, test := range tests {
+		attrs, err := s.List(ctx, ListOptions{Filters: test.filters, Limit: -1, RootID: -1})
+		if err != nil {
+			t.Errorf("List(%q): %v", test.filters, err)
+			continue
+		}
+		var got []int64
+		for _, attr := range attrs {
+			got = append(got, attr.ID.Int64)
+		}
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("List(%q) = %v, want %v", test.filters, got, test.want)
+		}
+	}
+}
+
+func TestParseTimeBounds(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	day := time.Date(2026, 1, 31, 0, 0, 0, 0, time.Local)
+	weekAgo := now.Add(-7 * 24 * time.Hour)
+	var open time.Time
+
+	tests := []struct {
+		value        string
+		since, until time.Time
+	}{
+		{"2026-01-31", day, day.AddDate(0, 0, 1)},
+		{">2026-01-31", day.AddDate(0, 0, 1), open},
+		{">=2026-01-31", day, open},
+		{"<2026-01-31", open, day},
+		{"<=2026-01-31", open, day.AddDate(0, 0, 1)},
+		{"<7d", weekAgo, open},
+		{"7d", weekAgo, open},
+		{">1w", open, weekAgo},
+	}
+	for _, test := range tests {
+		since, until, err := ParseTimeBounds(test.value, now)
+		if err != nil {
+			t.Errorf("ParseTimeBounds(%q): %v", test.value, err)
+			continue
+		}
+		if !since.Equal(test.since) || !until.Equal(test.until) {
+			t.Errorf("ParseTimeBounds(%q) = [%v, %v), want [%v, %v)", test.value, since, until, test.since, test.until)
+		}
+	}
+
+	if _, _, err := ParseTimeBounds("yesterday", now); err == nil {
+		t.Error("ParseTimeBounds(yesterday) did not fail")
+	}
+}
+
+func TestListPatternsAndCreated(t *testing.T) {
+	ctx, s := openTestStore(t)
+	createNote(t, ctx, s, "docker run", "")
+
+	since, until, err := ParseTimeBounds("<1d", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := ListOptions{Patterns: []string{"doc.er"}, Limit: -1, RootID: -1, CreatedSince: since, CreatedUntil: until}
+	if attrs, err := s.List(ctx, opts); err != nil || len(attrs) != 1 {
+		t.Errorf("List created <1d = %d notes, %v, want 1", len(attrs), err)
+	}
+
+	opts.CreatedSince, opts.CreatedUntil, _ = ParseTimeBounds(">1d", time.Now())
+	if attrs, err := s.List(ctx, opts); err != nil || len(attrs) != 0 {
+		t.Errorf("List created >1d = %d notes, %v, want 0", len(attrs), err)
+	}
+}
@@ -0,0 +1,63 @@
+package eton
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName is the sqlite3 driver with the REGEXP function, which SQLite
+// declares but does not implement.
+const driverName = "sqlite3_eton"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("regexp", sqlRegexp, true)
+		},
+	})
+}
+
+// maxCachedPatterns bounds regexpCache, it is emptied when full
+const maxCachedPatterns = 64
+
+// regexpCache holds the patterns compiled by sqlRegexp, which is called for
+// every row.
+var regexpCache = struct {
+	sync.Mutex
+	patterns map[string]*regexp.Regexp
+}{patterns: make(map[string]*regexp.Regexp)}
+
+// sqlRegexp implements "value REGEXP pattern" with the syntax of the regexp
+// package.
+func sqlRegexp(pattern, value string) (bool, error) {
+	regexpCache.Lock()
+	re, ok := regexpCache.patterns[pattern]
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			regexpCache.Unlock()
+			return false, err
+		}
+		if len(regexpCache.patterns) >= maxCachedPatterns {
+			regexpCache.patterns = make(map[string]*regexp.Regexp)
+		}
+		regexpCache.patterns[pattern] = re
+	}
+	regexpCache.Unlock()
+
+	return re.MatchString(value), nil
+}
+
+// validatePatterns returns an error for the first invalid pattern of a list.
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("eton: invalid pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package eton
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// bm25 weights for the value_text and alias columns, a match in the alias
+// ranks higher than a match in the body
+const sqlRank = "bm25(attributes_fts, 1.0, 10.0)"
+
+// execQueryer is implemented by *sql.DB and *sql.Tx.
+type execQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// ensureFullTextIndex creates the FTS5 index if sqlite was built with FTS5,
+// otherwise List matches the same word prefixes with REGEXP. The index is a
+// copy of the attributes, it is not part of the versioned schema: builds
+// without FTS5 never touch it, and the notes they change are queued in
+// fulltext_changes until a build with FTS5 opens the database again.
+func (s *SQLiteStore) ensureFullTextIndex(ctx context.Context) error {
+	var enabled bool
+	err := s.db.QueryRowContext(ctx, "SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled)
+	if err != nil || !enabled {
+		// built without -tags sqlite_fts5
+		return err
+	}
+
+	// before schema version 9, the index read its content from attributes
+	var external int
+	err = s.db.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master WHERE name = 'attributes_fts' AND sql LIKE '%content=%'").Scan(&external)
+	if err != nil {
+		return err
+	}
+	if external > 0 {
+		if _, err = s.db.ExecContext(ctx, "DROP TABLE attributes_fts"); err != nil {
+			return err
+		}
+	}
+
+	if _, err = s.db.ExecContext(ctx, "CREATE VIRTUAL TABLE IF NOT EXISTS attributes_fts USING fts5 (value_text, alias)"); err != nil {
+		return err
+	}
+	s.fullTextSearch = true
+	return s.syncFullText(ctx, s.db)
+}
+
+// syncFullText indexes the notes changed since the last call, by any build.
+func (s *SQLiteStore) syncFullText(ctx context.Context, db execQueryer) error {
+	var pending bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM fulltext_changes)").Scan(&pending)
+	if err != nil || !pending {
+		return err
+	}
+
+	for _, query := range []string{
+		"DELETE FROM attributes_fts WHERE rowid IN (SELECT id FROM fulltext_changes)",
+		"INSERT INTO attributes_fts (rowid, value_text, alias) SELECT id, value_text, alias FROM attributes WHERE id IN (SELECT id FROM fulltext_changes)",
+		"DELETE FROM fulltext_changes",
+	} {
+		if _, err = db.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FullTextSearch reports whether the full-text index is available.
+func (s *SQLiteStore) FullTextSearch() bool {
+	return s.fullTextSearch
+}
+
+// isFullTextFilter reports whether filter can be answered by the index.
+func (s *SQLiteStore) isFullTextFilter(filter string) bool {
+	return s.fullTextSearch && hasWords(filter)
+}
+
+// hasWords reports whether str has any letters or digits. Filters without
+// them, e.g. "[ ]", are matched with LIKE, because the tokenizer drops
+// punctuation.
+func hasWords(str string) bool {
+	return strings.IndexFunc(str, isWordRune) >= 0
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wordPattern translates a filter into the regular expression matching what
+// the index matches: the words of the filter in a row, ignoring case and the
+// punctuation between them, the last one as a prefix unless phrase is set.
+// "ock" does not match "docker" in either build.
+func wordPattern(filter string, phrase bool) string {
+	words := strings.FieldsFunc(filter, func(r rune) bool { return !isWordRune(r) })
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+	}
+
+	pattern := `(?i)(^|[^\pL\pN])` + strings.Join(words, `[^\pL\pN]+`)
+	if phrase {
+		pattern += `($|[^\pL\pN])`
+	}
+	return pattern
+}
+
+// fullTextQuery translates filters into an FTS5 MATCH expression.
+// A filter wrapped in double quotes is a phrase, every other filter is a
+// prefix query, so that "doc" matches "docker".
+func fullTextQuery(filters []string) string {
+	terms := make([]string, 0, len(filters))
+	for _, filter := range filters {
+		if len(filter) > 1 && strings.HasPrefix(filter, `"`) && strings.HasSuffix(filter, `"`) {
+			terms = append(terms, quoteFullText(filter[1:len(filter)-1]))
+		} else {
+			terms = append(terms, quoteFullText(strings.TrimSuffix(filter, "*"))+"*")
+		}
+	}
+	return strings.Join(terms, " AND ")
+}
+
+func quoteFullText(str string) string {
+	return `"` + strings.Replace(str, `"`, `""`, -1) + `"`
+}
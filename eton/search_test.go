@@ -0,0 +1,121 @@
+package eton
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+// listIDs returns the sorted IDs of the notes matching filters.
+func listIDs(t *testing.T, s *SQLiteStore, filters ...string) []int64 {
+	t.Helper()
+	attrs, err := s.List(context.Background(), ListOptions{Filters: filters, Limit: -1, RootID: -1})
+	if err != nil {
+		t.Fatalf("List(%q): %v", filters, err)
+	}
+	var ids []int64
+	for _, attr := range attrs {
+		ids = append(ids, attr.ID.Int64)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestWordPattern(t *testing.T) {
+	tests := []struct {
+		filter string
+		phrase bool
+		text   string
+		want   bool
+	}{
+		{"dock", false, "docker run", true},
+		{"dock", false, "run Docker", true},
+		{"ock", false, "docker", false},
+		{"a.b", false, "a-b", true},
+		{"http://x", false, "see http://xyz", true},
+		{"exact phrase", true, "an exact phrase.", true},
+		{"exact phras", true, "an exact phrase", false},
+		{"été", false, "l'Été", true},
+	}
+	for _, test := range tests {
+		pattern := wordPattern(test.filter, test.phrase)
+		if got := regexp.MustCompile(pattern).MatchString(test.text); got != test.want {
+			t.Errorf("wordPattern(%q, %v) = %s matches %q: %v, want %v", test.filter, test.phrase, pattern, test.text, got, test.want)
+		}
+	}
+}
+
+// TestSearchWords passes with and without -tags sqlite_fts5: both builds
+// match the same notes.
+func TestSearchWords(t *testing.T) {
+	ctx, s := openTestStore(t)
+	createNote(t, ctx, s, "docker run", "")
+	createNote(t, ctx, s, "see http://x.org", "")
+	createNote(t, ctx, s, "exact phrase here", "")
+	createNote(t, ctx, s, "todo", "proc-notes")
+	createNote(t, ctx, s, "- [ ] buy milk", "")
+
+	tests := []struct {
+		filters []string
+		want    []int64
+	}{
+		{[]string{"dock"}, []int64{1}},
+		{[]string{"DOCKER"}, []int64{1}},
+		{[]string{"ock"}, nil},
+		{[]string{"http://x"}, []int64{2}},
+		{[]string{`"exact phrase"`}, []int64{3}},
+		{[]string{`"exact phras"`}, nil},
+		{[]string{"phras"}, []int64{3}},
+		{[]string{"notes"}, []int64{4}},
+		{[]string{"otes"}, nil},
+		{[]string{"[ ]"}, []int64{5}},
+		{[]string{"NOT dock"}, []int64{2, 3, 4, 5}},
+	}
+	for _, test := range tests {
+		if got := listIDs(t, s, test.filters...); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("List(%q) = %v, want %v (full-text index: %v)", test.filters, got, test.want, s.FullTextSearch())
+		}
+	}
+}
+
+func TestSearchChangedNotes(t *testing.T) {
+	ctx, s := openTestStore(t)
+	id := createNote(t, ctx, s, "docker run", "")
+	if _, err := s.Update(ctx, id, "podman run"); err != nil {
+		t.Fatal(err)
+	}
+	if got := listIDs(t, s, "podman"); fmt.Sprint(got) != fmt.Sprint([]int64{id}) {
+		t.Errorf("List(podman) = %v, want [%d]", got, id)
+	}
+	if got := listIDs(t, s, "docker"); len(got) != 0 {
+		t.Errorf("List(docker) = %v after the update, want none", got)
+	}
+
+	if _, err := s.Remove(ctx, id, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Purge(ctx, []int64{id}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := listIDs(t, s, "podman"); len(got) != 0 {
+		t.Errorf("List(podman) = %v after the purge, want none", got)
+	}
+
+	var pending int
+	if err := s.db.QueryRow("SELECT count(*) FROM fulltext_changes").Scan(&pending); err != nil {
+		t.Fatal(err)
+	}
+	if !s.FullTextSearch() {
+		return
+	}
+	var indexed int
+	if err := s.db.QueryRow("SELECT count(*) FROM attributes_fts").Scan(&indexed); err != nil {
+		t.Fatal(err)
+	}
+	if pending != 0 || indexed != 0 {
+		t.Errorf("%d notes queued and %d indexed after the purge, want none", pending, indexed)
+	}
+}
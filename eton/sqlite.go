@@ -0,0 +1,608 @@
+package eton
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const orderby = "CASE WHEN updated_at IS NULL THEN created_at ELSE updated_at END DESC"
+
+// sqlModifiedAt is when a note was last updated, or created if it was never
+// updated
+const sqlModifiedAt = "COALESCE(updated_at, created_at)"
+
+const sqlSelect = "id, value_text, name, parent_id, alias, mark, value_blob, created_at, updated_at, frequency, value_int, value_real, accessed_at, deleted_at, version, file_mode, file_modified_at, mime_type"
+
+// sqlSubtree selects the ID of a note and its descendants
+const sqlSubtree = `WITH RECURSIVE subtree (id) AS (
+		SELECT ?
+		UNION
+		SELECT attributes.id FROM attributes JOIN subtree ON attributes.parent_id = subtree.id
+	) `
+
+var validAlias = regexp.MustCompile(`[^\s\d]+`)
+
+// scanDest returns pointers to attr's fields in the order of sqlSelect.
+func (attr *Attr) scanDest() []interface{} {
+	return []interface{}{
+		&attr.ID, &attr.ValueText, &attr.Name, &attr.ParentID, &attr.Alias, &attr.Mark, &attr.ValueBlob, &attr.CreatedAt, &attr.UpdatedAt,
+		&attr.Frequency, &attr.ValueInt, &attr.ValueReal, &attr.AccessedAt, &attr.DeletedAt, &attr.Version,
+		&attr.FileMode, &attr.FileModifiedAt, &attr.MimeType,
+	}
+}
+
+// SQLiteStore is the Store implementation on top of an SQLite database.
+type SQLiteStore struct {
+	db             *sql.DB
+	migrated       int
+	fullTextSearch bool
+	untracked      bool
+}
+
+var _ Store = (*SQLiteStore)(nil)
+
+// Open opens the database at path, creating it if it does not exist, and
+// upgrades its schema.
+func Open(ctx context.Context, path string) (*SQLiteStore, error) {
+	db, err := sql.Open(driverName, path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SQLiteStore{db: db}
+	if s.migrated, err = migrate(ctx, db); err == nil {
+		err = s.ensureFullTextIndex(ctx)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Migrated returns the number of migrations applied by Open.
+func (s *SQLiteStore) Migrated() int {
+	return s.migrated
+}
+
+// SchemaVersion returns the version of the database schema.
+func (s *SQLiteStore) SchemaVersion(ctx context.Context) (int, error) {
+	return schemaVersion(ctx, s.db)
+}
+
+// Close closes the database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// rowsAffected returns the number of rows affected by an Exec.
+func rowsAffected(result sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// rowsFound is rowsAffected for updates of a single note, it returns
+// ErrNotFound if no row was updated.
+func rowsFound(result sql.Result, err error) (int64, error) {
+	n, err := rowsAffected(result, err)
+	if err == nil && n == 0 {
+		err = ErrNotFound
+	}
+	return n, err
+}
+
+// queryAttrs returns the attributes selected by query, which must select
+// sqlSelect. Their tags are loaded by a second query, joined to the first.
+func (s *SQLiteStore) queryAttrs(ctx context.Context, query string, args ...interface{}) (attrs []Attr, err error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attrs = make([]Attr, 0, 0)
+	byID := make(map[int64]int)
+	for rows.Next() {
+		var attr Attr
+		if err = rows.Scan(attr.scanDest()...); err != nil {
+			return nil, err
+		}
+		byID[attr.ID.Int64] = len(attrs)
+		attrs = append(attrs, attr)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(attrs) == 0 {
+		return attrs, nil
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(ctx, "SELECT tags.attribute_id, tags.tag FROM tags JOIN ("+query+") AS selected ON selected.id = tags.attribute_id ORDER BY tags.tag", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var tag string
+		if err = rows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[id]; ok {
+			attrs[i].Tags = append(attrs[i].Tags, tag)
+		}
+	}
+	return attrs, rows.Err()
+}
+
+// getOne returns the first attribute selected by query.
+func (s *SQLiteStore) getOne(ctx context.Context, query string, args ...interface{}) (attr Attr, err error) {
+	err = s.db.QueryRowContext(ctx, query, args...).Scan(attr.scanDest()...)
+	if err == sql.ErrNoRows {
+		return attr, ErrNotFound
+	}
+	if err != nil {
+		return attr, err
+	}
+
+	attr.Tags, err = s.Tags(ctx, attr.ID.Int64)
+	return attr, err
+}
+
+// accessed counts an access to attr, unless err is not nil.
+func (s *SQLiteStore) accessed(ctx context.Context, attr Attr, err error) (Attr, error) {
+	if err != nil {
+		return attr, err
+	}
+	return attr, s.trackAccess(ctx, attr.ID.Int64)
+}
+
+// Get returns the attribute with the given ID.
+func (s *SQLiteStore) Get(ctx context.Context, id int64) (Attr, error) {
+	attr, err := s.get(ctx, id)
+	return s.accessed(ctx, attr, err)
+}
+
+func (s *SQLiteStore) get(ctx context.Context, id int64) (Attr, error) {
+	return s.getOne(ctx, "SELECT "+sqlSelect+" FROM attributes WHERE id = ? AND deleted_at IS NULL LIMIT 1", id)
+}
+
+// FindByAlias returns the attribute with the given alias. Unless exact is
+// true, it falls back to the best fuzzy match, see PickMatch.
+func (s *SQLiteStore) FindByAlias(ctx context.Context, alias string, exact bool) (Attr, error) {
+	attr, err := s.findByAlias(ctx, alias, exact)
+	return s.accessed(ctx, attr, err)
+}
+
+func (s *SQLiteStore) findByAlias(ctx context.Context, alias string, exact bool) (attr Attr, err error) {
+	attr, err = s.getOne(ctx, "SELECT "+sqlSelect+" FROM attributes WHERE alias = ? ORDER BY "+orderby+" LIMIT 1", alias)
+	if exact || !errors.Is(err, ErrNotFound) {
+		return attr, err
+	}
+	return s.findFuzzy(ctx, alias)
+}
+
+func (s *SQLiteStore) findFuzzy(ctx context.Context, alias string) (Attr, error) {
+	matches, err := s.MatchAlias(ctx, alias)
+	if err != nil {
+		return Attr{}, err
+	}
+	attr, err := PickMatch(alias, matches, false)
+	if err != nil {
+		return attr, err
+	}
+	return s.get(ctx, attr.ID.Int64)
+}
+
+// Find returns the attribute with the given alias, or else ID, or else the
+// best fuzzy match of the alias.
+func (s *SQLiteStore) Find(ctx context.Context, identifier string) (Attr, error) {
+	attr, err := s.find(ctx, identifier)
+	return s.accessed(ctx, attr, err)
+}
+
+func (s *SQLiteStore) find(ctx context.Context, identifier string) (Attr, error) {
+	attr, err := s.findByAlias(ctx, identifier, true)
+	if !errors.Is(err, ErrNotFound) {
+		return attr, err
+	}
+
+	if id, convErr := strconv.ParseInt(identifier, 10, 64); convErr == nil {
+		if attr, err = s.get(ctx, id); !errors.Is(err, ErrNotFound) {
+			return attr, err
+		}
+	}
+	return s.findFuzzy(ctx, identifier)
+}
+
+// Last returns the most recently created or updated note.
+func (s *SQLiteStore) Last(ctx context.Context) (Attr, error) {
+	attr, err := s.getOne(ctx, "SELECT "+sqlSelect+" FROM attributes WHERE deleted_at IS NULL ORDER BY "+orderby+" LIMIT 1")
+	return s.accessed(ctx, attr, err)
+}
+
+// List returns the attributes selected by opts, best matches first.
+func (s *SQLiteStore) List(ctx context.Context, opts ListOptions) ([]Attr, error) {
+	return s.list(ctx, opts, 0)
+}
+
+func (s *SQLiteStore) list(ctx context.Context, opts ListOptions, depth int) (attrs []Attr, err error) {
+	var nolimit = opts.Limit == -1
+
+	var sqlConditions string
+	var sqlLimit string
+	var sqlFrom = "attributes"
+
+	queryValues := make([]interface{}, 0, 5)
+
+	sqlOrderBy, err := orderByClause(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+	query, err := ParseQuery(opts.Filters)
+	if err != nil {
+		return nil, err
+	}
+	if err = validatePatterns(opts.Patterns); err != nil {
+		return nil, err
+	}
+	searching := !query.Empty() || len(opts.Patterns) > 0 || !opts.Since.IsZero() || !opts.Until.IsZero() ||
+		!opts.CreatedSince.IsZero() || !opts.CreatedUntil.IsZero()
+
+	if opts.Removed {
+		sqlConditions = "deleted_at IS NOT NULL"
+	} else {
+		sqlConditions = "deleted_at IS NULL"
+	}
+
+	if opts.RootID != -1 {
+		nolimit = true
+		sqlConditions += fmt.Sprintf(" AND parent_id = %d ", opts.RootID)
+	} else if !searching {
+		// filters search notes at any depth
+		sqlConditions += " AND parent_id IS NULL"
+	}
+
+	if opts.MarkedOnly {
+		// sqlConditions += " AND ((alias IS NOT NULL AND alias != '') OR mark > 0)"
+		sqlConditions += " AND mark > 0"
+	}
+
+	for _, bounds := range []struct {
+		column       string
+		since, until time.Time
+	}{
+		{sqlModifiedAt, opts.Since, opts.Until},
+		{"created_at", opts.CreatedSince, opts.CreatedUntil},
+	} {
+		if condition, args := timeCondition(bounds.column, bounds.since, bounds.until); len(condition) > 0 {
+			sqlConditions += " AND " + condition
+			queryValues = append(queryValues, args...)
+		}
+	}
+
+	if opts.RootID == -1 && !query.Empty() {
+		nolimit = true
+		if s.fullTextSearch {
+			// notes may have been changed by a build without FTS5
+			if err = s.syncFullText(ctx, s.db); err != nil {
+				return nil, err
+			}
+		}
+		where, whereValues, rank := s.compileQuery(query)
+		if len(where) > 0 {
+			sqlConditions += " AND " + where
+			queryValues = append(queryValues, whereValues...)
+		}
+
+		if len(rank) > 0 {
+			sqlFrom += " JOIN (SELECT rowid, " + sqlRank + " AS score FROM attributes_fts WHERE attributes_fts MATCH ?) AS fts ON fts.rowid = attributes.id"
+			if len(opts.Sort) == 0 {
+				// best matches first, the most frecent of equal matches
+				sqlOrderBy = "fts.score, " + sqlFrecency + " DESC, " + orderby
+			}
+			queryValues = append([]interface{}{fullTextQuery(rank)}, queryValues...)
+		}
+	}
+
+	if opts.RootID == -1 && len(opts.Patterns) > 0 {
+		nolimit = true
+		for _, pattern := range opts.Patterns {
+			sqlConditions += " AND (COALESCE(value_text, '') REGEXP ? OR COALESCE(alias, '') REGEXP ?)"
+			queryValues = append(queryValues, pattern, pattern)
+		}
+	}
+
+	if nolimit && !(opts.Paged && opts.Limit != -1) {
+		sqlLimit = ""
+	} else {
+		queryValues = append(queryValues, opts.Offset)
+		queryValues = append(queryValues, opts.Limit)
+		sqlLimit = "LIMIT ?, ?"
+	}
+
+	attrs, err = s.queryAttrs(ctx, "SELECT "+sqlSelect+" FROM "+sqlFrom+" WHERE "+sqlConditions+" ORDER BY "+sqlOrderBy+" "+sqlLimit, queryValues...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range attrs {
+		attrs[i].Depth = depth
+	}
+
+	if opts.Recursive && !searching {
+		tree := make([]Attr, 0, len(attrs))
+		for _, attr := range attrs {
+			optsNew := opts
+			optsNew.RootID = attr.ID.Int64
+			children, err := s.list(ctx, optsNew, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			tree = append(tree, attr)
+			tree = append(tree, children...)
+		}
+		attrs = tree
+	}
+	return attrs, nil
+}
+
+// ListAll returns every attribute, including removed ones and the ones
+// under other notes, ordered by ID.
+func (s *SQLiteStore) ListAll(ctx context.Context) ([]Attr, error) {
+	return s.queryAttrs(ctx, "SELECT "+sqlSelect+" FROM attributes ORDER BY id")
+}
+
+// CreateNote creates a note, parentID is -1 for a top-level note.
+func (s *SQLiteStore) CreateNote(ctx context.Context, valueText string, parentID int64) (int64, error) {
+	return s.Insert(ctx, Attr{
+		Name:      sql.NullString{String: "note", Valid: true},
+		ParentID:  sqlNullInt64(parentID),
+		ValueText: sql.NullString{String: valueText, Valid: true},
+	})
+}
+
+// AddFile stores the content of the file at path, with its permission bits,
+// modification time and MIME type.
+func (s *SQLiteStore) AddFile(ctx context.Context, path string, content []byte, mode os.FileMode, modTime time.Time) (int64, error) {
+	return s.Insert(ctx, Attr{
+		Name:           sql.NullString{String: "file", Valid: true},
+		ValueText:      sql.NullString{String: path, Valid: true},
+		ValueBlob:      content,
+		FileMode:       sql.NullInt64{Int64: int64(mode.Perm()), Valid: true},
+		FileModifiedAt: NullTime{Time: modTime, Valid: !modTime.IsZero()},
+		MimeType:       sql.NullString{String: DetectMimeType(path, content), Valid: true},
+	})
+}
+
+// Insert creates an attribute from all the fields of attr, an invalid ID
+// lets the database choose one. created_at defaults to now.
+func (s *SQLiteStore) Insert(ctx context.Context, attr Attr) (lastInsertID int64, err error) {
+	var valueBlob interface{}
+	if attr.ValueBlob != nil {
+		valueBlob = attr.ValueBlob
+	}
+
+	result, err := s.db.ExecContext(ctx, `INSERT INTO attributes (id, name, alias, mark, parent_id, value_text, value_blob, created_at, updated_at, deleted_at, file_mode, file_modified_at, mime_type)
+		VALUES (?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), ?, ?, ?, ?, ?)`,
+		attr.ID, attr.Name, attr.Alias, attr.Mark.Int64, attr.ParentID, attr.ValueText, valueBlob,
+		attr.CreatedAt, attr.UpdatedAt, attr.DeletedAt, attr.FileMode, attr.FileModifiedAt, attr.MimeType)
+	if err != nil {
+		return 0, aliasError(err)
+	}
+
+	if lastInsertID, err = result.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	if attr.ValueBlob == nil {
+		if err = s.syncReferences(ctx, lastInsertID, attr.ValueText.String); err != nil {
+			return lastInsertID, err
+		}
+	}
+
+	_, err = s.addTags(ctx, lastInsertID, attr.Tags, false)
+	return lastInsertID, err
+}
+
+// syncReferences updates the #tags and [[links]] parsed from a note.
+func (s *SQLiteStore) syncReferences(ctx context.Context, id int64, valueText string) error {
+	if err := s.syncHashtags(ctx, id, valueText); err != nil {
+		return err
+	}
+	return s.syncLinks(ctx, id, valueText)
+}
+
+// Update replaces the content of a note.
+func (s *SQLiteStore) Update(ctx context.Context, id int64, valueText string) (int64, error) {
+	if encrypted, err := s.isEncrypted(ctx, id); err != nil || encrypted {
+		if encrypted {
+			err = ErrEncrypted
+		}
+		return 0, err
+	}
+
+	n, err := rowsAffected(s.db.ExecContext(ctx, "UPDATE attributes SET value_text = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", valueText, id))
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, ErrNotFound
+	}
+	return n, s.syncReferences(ctx, id, valueText)
+}
+
+// UpdateIfVersion replaces the content of a note if its version is still
+// version, and returns the new version. Otherwise it returns ErrConflict.
+func (s *SQLiteStore) UpdateIfVersion(ctx context.Context, id int64, valueText string, version int64) (int64, error) {
+	if encrypted, err := s.isEncrypted(ctx, id); err != nil || encrypted {
+		if encrypted {
+			err = ErrEncrypted
+		}
+		return 0, err
+	}
+
+	newVersion, err := s.updateIfVersion(ctx, id, "value_text", valueText, version)
+	if err != nil {
+		return 0, err
+	}
+	return newVersion, s.syncReferences(ctx, id, valueText)
+}
+
+// UpdateBlobIfVersion is UpdateIfVersion for files and encrypted notes.
+func (s *SQLiteStore) UpdateBlobIfVersion(ctx context.Context, id int64, valueBlob []byte, version int64) (int64, error) {
+	return s.updateIfVersion(ctx, id, "value_blob", valueBlob, version)
+}
+
+// updateIfVersion reads the new version in the transaction of the update,
+// so that it is not the version of a concurrent update.
+func (s *SQLiteStore) updateIfVersion(ctx context.Context, id int64, column string, value interface{}, version int64) (newVersion int64, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n, err := rowsAffected(tx.ExecContext(ctx, "UPDATE attributes SET "+column+" = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND version = ?", value, id, version))
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT version FROM attributes WHERE id = ?", id).Scan(&newVersion)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return newVersion, fmt.Errorf("%w: version %d was saved after version %d", ErrConflict, newVersion, version)
+	}
+	return newVersion, tx.Commit()
+}
+
+// UpdateBlob replaces the content of a file.
+func (s *SQLiteStore) UpdateBlob(ctx context.Context, id int64, valueBlob []byte) (int64, error) {
+	return rowsFound(s.db.ExecContext(ctx, "UPDATE attributes SET value_blob = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", valueBlob, id))
+}
+
+// SetAlias sets the alias of an attribute, or unsets it if alias is empty.
+// [[links]] to the previous alias are rewritten to the new alias, or to the
+// ID if the alias is unset.
+func (s *SQLiteStore) SetAlias(ctx context.Context, id int64, alias string) (linksUpdated int64, err error) {
+	unset := len(alias) == 0
+	if !unset && !validAlias.MatchString(alias) {
+		return 0, ErrInvalidAlias
+	}
+
+	var oldAlias sql.NullString
+	err = s.db.QueryRowContext(ctx, "SELECT alias FROM attributes WHERE id = ?", id).Scan(&oldAlias)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	newAlias := sql.NullString{String: alias, Valid: !unset}
+	if _, err = s.db.ExecContext(ctx, "UPDATE attributes SET alias = ? WHERE id = ?", newAlias, id); err != nil {
+		return 0, aliasError(err)
+	}
+
+	newText := alias
+	if unset {
+		newText = strconv.FormatInt(id, 10)
+	}
+	return s.renameLinks(ctx, id, oldAlias.String, newText)
+}
+
+// aliasError translates a violation of the unique index on alias.
+func aliasError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return ErrAliasTaken
+	}
+	return err
+}
+
+// SetMark sets the mark of a note that is not removed.
+func (s *SQLiteStore) SetMark(ctx context.Context, id int64, mark int) (int64, error) {
+	return rowsFound(s.db.ExecContext(ctx, "UPDATE attributes SET mark = ? WHERE id = ? AND deleted_at IS NULL", mark, id))
+}
+
+// SetParent moves a note under another, or to the top level if parentID is
+// -1. It refuses to move a note under itself or its descendants.
+func (s *SQLiteStore) SetParent(ctx context.Context, id int64, parentID int64) (int64, error) {
+	if parentID != -1 {
+		var isDescendant int
+		err := s.db.QueryRowContext(ctx, sqlSubtree+"SELECT count(*) FROM subtree WHERE id = ?", id, parentID).Scan(&isDescendant)
+		if err != nil {
+			return 0, err
+		}
+		if isDescendant > 0 {
+			return 0, ErrCycle
+		}
+	}
+
+	return rowsFound(s.db.ExecContext(ctx, "UPDATE attributes SET parent_id = ? WHERE id = ?", sqlNullInt64(parentID), id))
+}
+
+// Count returns the number of notes that are not removed.
+func (s *SQLiteStore) Count(ctx context.Context) (count int, err error) {
+	err = s.db.QueryRowContext(ctx, "SELECT count(*) FROM attributes WHERE deleted_at IS NULL").Scan(&count)
+	return count, err
+}
+
+// CountChildren returns the number of notes directly under a note that are
+// not removed.
+func (s *SQLiteStore) CountChildren(ctx context.Context, id int64) (count int, err error) {
+	err = s.db.QueryRowContext(ctx, "SELECT count(*) FROM attributes WHERE parent_id = ? AND deleted_at IS NULL", id).Scan(&count)
+	return count, err
+}
+
+// Remove marks a note, and with recursive its descendants, as removed.
+func (s *SQLiteStore) Remove(ctx context.Context, id int64, recursive bool) (int64, error) {
+	if recursive {
+		return rowsFound(s.db.ExecContext(ctx, sqlSubtree+"UPDATE attributes SET deleted_at = CURRENT_TIMESTAMP WHERE id IN subtree AND deleted_at IS NULL", id))
+	}
+
+	count, err := s.CountChildren(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, fmt.Errorf("%w: %d notes", ErrHasChildren, count)
+	}
+	return rowsFound(s.db.ExecContext(ctx, "UPDATE attributes SET deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL", id))
+}
+
+// Unremove recovers a removed note, and with recursive its descendants.
+func (s *SQLiteStore) Unremove(ctx context.Context, id int64, recursive bool) (n int64, err error) {
+	if recursive {
+		n, err = rowsAffected(s.db.ExecContext(ctx, sqlSubtree+"UPDATE attributes SET deleted_at = NULL WHERE id IN subtree AND deleted_at IS NOT NULL", id))
+	} else {
+		n, err = rowsAffected(s.db.ExecContext(ctx, "UPDATE attributes SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id))
+	}
+	if err != nil || n > 0 {
+		return n, err
+	}
+
+	// nothing to recover, unless the note does not exist
+	var exists int
+	if err = s.db.QueryRowContext(ctx, "SELECT count(*) FROM attributes WHERE id = ?", id).Scan(&exists); err == nil && exists == 0 {
+		err = ErrNotFound
+	}
+	return 0, err
+}
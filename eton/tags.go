@@ -0,0 +1,133 @@
+package eton
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// hashtagRegexp matches #tag at the beginning of a word. "# Title" and
+// "#123" are not tags.
+var hashtagRegexp = regexp.MustCompile(`(?:^|[\s(\[,;])#([\p{L}\p{N}_][\p{L}\p{N}_/-]*)`)
+
+// NormalizeTag strips the "#" or "+" prefix and lowercases tag. It returns
+// an empty string if tag is not a valid tag.
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimLeft(tag, "#+"))
+	if strings.IndexFunc(tag, func(r rune) bool { return r < '0' || r > '9' }) == -1 {
+		// empty or numeric
+		return ""
+	}
+	return tag
+}
+
+// ParseHashtags returns the unique #tags in text, in order of appearance.
+func ParseHashtags(text string) (tags []string) {
+	seen := make(map[string]bool)
+	for _, match := range hashtagRegexp.FindAllStringSubmatch(text, -1) {
+		tag := NormalizeTag(strings.TrimRight(match[1], "/-"))
+		if len(tag) > 0 && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// IsTagFilter reports whether a List filter is "+tag" or "-tag".
+func IsTagFilter(filter string) bool {
+	return len(filter) > 1 && (filter[0] == '+' || filter[0] == '-') && len(NormalizeTag(filter[1:])) > 0
+}
+
+// Tags returns the tags of an attribute sorted by name.
+func (s *SQLiteStore) Tags(ctx context.Context, id int64) (tags []string, err error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT tag FROM tags WHERE attribute_id = ? ORDER BY tag", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag string
+		if err = rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// AddTags tags an attribute, it returns the number of new tags.
+func (s *SQLiteStore) AddTags(ctx context.Context, id int64, tags []string) (int64, error) {
+	return s.addTags(ctx, id, tags, false)
+}
+
+// addTags tags an attribute, fromBody is true for tags parsed from the
+// note's content.
+func (s *SQLiteStore) addTags(ctx context.Context, id int64, tags []string, fromBody bool) (count int64, err error) {
+	stmt, err := s.db.PrepareContext(ctx, "INSERT OR IGNORE INTO tags (attribute_id, tag, from_body) VALUES (?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, tag := range tags {
+		if tag = NormalizeTag(tag); len(tag) == 0 {
+			continue
+		}
+		n, err := rowsAffected(stmt.ExecContext(ctx, id, tag, fromBody))
+		if err != nil {
+			return count, err
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// RemoveTags untags an attribute, it returns the number of removed tags.
+func (s *SQLiteStore) RemoveTags(ctx context.Context, id int64, tags []string) (count int64, err error) {
+	stmt, err := s.db.PrepareContext(ctx, "DELETE FROM tags WHERE attribute_id = ? AND tag = ?")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, tag := range tags {
+		n, err := rowsAffected(stmt.ExecContext(ctx, id, NormalizeTag(tag)))
+		if err != nil {
+			return count, err
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// syncHashtags replaces the tags previously parsed from a note's content
+// with the #tags in valueText. Tags added with AddTags are kept.
+func (s *SQLiteStore) syncHashtags(ctx context.Context, id int64, valueText string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM tags WHERE attribute_id = ? AND from_body = 1", id); err != nil {
+		return err
+	}
+	_, err := s.addTags(ctx, id, ParseHashtags(valueText), true)
+	return err
+}
+
+// TagCounts returns every tag with the number of notes tagged with it, most
+// used first.
+func (s *SQLiteStore) TagCounts(ctx context.Context) (counts []TagCount, err error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT tag, count(*) FROM tags JOIN attributes ON attributes.id = tags.attribute_id
+		WHERE deleted_at IS NULL GROUP BY tag ORDER BY count(*) DESC, tag`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var count TagCount
+		if err = rows.Scan(&count.Tag, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,136 @@
+package eton
+
+import (
+	"context"
+	"time"
+)
+
+// TrashItem is a removed note.
+type TrashItem struct {
+	Attr
+	Size int64 // bytes of the content and the revisions of the note
+}
+
+// sqlNoteSize is the number of bytes of the content and the revisions of a
+// note
+const sqlNoteSize = `COALESCE(length(CAST(value_text AS BLOB)), 0) + COALESCE(length(value_blob), 0) +
+	COALESCE((SELECT sum(length(CAST(revisions.value_text AS BLOB))) FROM revisions WHERE revisions.attribute_id = attributes.id), 0)`
+
+// Trash returns the removed notes, the last removed first.
+func (s *SQLiteStore) Trash(ctx context.Context) (items []TrashItem, err error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+sqlSelect+", "+sqlNoteSize+" FROM attributes WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item TrashItem
+		if err = rows.Scan(append(item.scanDest(), &item.Size)...); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Purge deletes removed notes for good, with their revisions, tags and
+// links. ids selects removed notes and the removed notes under them, every
+// removed note if empty. Unless zero, only the notes removed before
+// removedBefore are purged. Notes left under a purged note are moved to the
+// top level.
+func (s *SQLiteStore) Purge(ctx context.Context, ids []int64, removedBefore time.Time) (purged int64, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	condition := "deleted_at IS NOT NULL"
+	var args []interface{}
+	if !removedBefore.IsZero() {
+		condition += " AND datetime(deleted_at) < datetime(?)"
+		args = append(args, removedBefore.UTC().Format(sqlTimeLayout))
+	}
+
+	var selected []int64
+	selectIDs := func(query string, args ...interface{}) error {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			selected = append(selected, id)
+		}
+		return rows.Err()
+	}
+
+	if len(ids) == 0 {
+		err = selectIDs("SELECT id FROM attributes WHERE "+condition, args...)
+	}
+	for _, id := range ids {
+		if err = selectIDs(sqlSubtree+"SELECT id FROM attributes WHERE id IN subtree AND "+condition, append([]interface{}{id}, args...)...); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	seen := make(map[int64]bool)
+	for _, id := range selected {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		for _, query := range []string{
+			"DELETE FROM revisions WHERE attribute_id = ?",
+			"DELETE FROM tags WHERE attribute_id = ?",
+			"DELETE FROM links WHERE source_id = ?",
+			// the links to it resolve again if the alias is reused
+			"UPDATE links SET target_id = NULL WHERE target_id = ?",
+			"UPDATE attributes SET parent_id = NULL WHERE parent_id = ?",
+		} {
+			if _, err = tx.ExecContext(ctx, query, id); err != nil {
+				return 0, err
+			}
+		}
+
+		count, err := rowsAffected(tx.ExecContext(ctx, "DELETE FROM attributes WHERE id = ?", id))
+		if err != nil {
+			return 0, err
+		}
+		purged += count
+	}
+	return purged, tx.Commit()
+}
+
+// Vacuum rebuilds the database file, which keeps the space freed by deleted
+// rows until then. It returns the number of bytes reclaimed.
+func (s *SQLiteStore) Vacuum(ctx context.Context) (reclaimed int64, err error) {
+	before, err := s.fileSize(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = s.db.ExecContext(ctx, "VACUUM"); err != nil {
+		return 0, err
+	}
+	after, err := s.fileSize(ctx)
+	return before - after, err
+}
+
+// fileSize returns the size of the database file, in bytes.
+func (s *SQLiteStore) fileSize(ctx context.Context) (size int64, err error) {
+	var pageCount, pageSize int64
+	if err = s.db.QueryRowContext(ctx, "PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, err
+	}
+	err = s.db.QueryRowContext(ctx, "PRAGMA page_size").Scan(&pageSize)
+	return pageCount * pageSize, err
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siadat/eton/eton"
+)
+
+// frontMatterTimeLayout is the layout of timestamps in exported files
+const frontMatterTimeLayout = time.RFC3339
+
+// listAllAttributes returns every attribute, including removed ones and
+// the ones under other notes, ordered by ID.
+func listAllAttributes(ctx context.Context, store eton.Store) []attrStruct {
+	attrs, err := store.ListAll(ctx)
+	check(err)
+	return attrsFromStore(attrs)
+}
+
+// exportMarkdown writes every attribute to dir. A note is written to
+// <id>.md, its content preceded by YAML front matter. A file added with
+// "eton addfile" is written as <id>-<basename> with its metadata in
+// <id>-<basename>.yml. Encrypted notes are written as <id>.enc, with a
+// <id>.enc.yml sidecar. The output only depends on the database content.
+func exportMarkdown(ctx context.Context, store eton.Store, dir string) (count int, err error) {
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return 0, err
+	}
+
+	for _, attr := range listAllAttributes(ctx, store) {
+		if attr.isFile() || attr.isEncrypted() {
+			filename := attr.getIDString() + "-" + filepath.Base(attr.getTextValue())
+			if attr.isEncrypted() {
+				filename = attr.getIDString() + ".enc"
+			}
+			err = ioutil.WriteFile(filepath.Join(dir, filename), attr.ValueBlob, 0600)
+			if err == nil {
+				err = ioutil.WriteFile(filepath.Join(dir, filename+".yml"), []byte(attr.frontMatter()), 0600)
+			}
+		} else {
+			content := "---\n" + attr.frontMatter() + "---\n" + attr.getTextValue()
+			err = ioutil.WriteFile(filepath.Join(dir, attr.getIDString()+".md"), []byte(content), 0600)
+		}
+
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// isFile reports whether attr was added with "eton addfile".
+func (attr attrStruct) isFile() bool {
+	return attr.Name.Valid && attr.Name.String == "file"
+}
+
+// frontMatter returns attr's metadata as YAML, without the "---" lines.
+func (attr attrStruct) frontMatter() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "id: %d\n", attr.getID())
+	if attr.isFile() || attr.isEncrypted() {
+		fmt.Fprintf(&b, "name: %s\n", yamlString(attr.Name))
+		fmt.Fprintf(&b, "path: %s\n", yamlString(attr.ValueText))
+		fmt.Fprintf(&b, "file_mode: %s\n", yamlFileMode(attr.FileMode))
+		fmt.Fprintf(&b, "file_modified_at: %s\n", yamlTime(attr.FileModifiedAt))
+		fmt.Fprintf(&b, "mime_type: %s\n", yamlString(attr.MimeType))
+	}
+	fmt.Fprintf(&b, "alias: %s\n", yamlString(attr.Alias))
+	fmt.Fprintf(&b, "mark: %d\n", attr.Mark.Int64)
+	fmt.Fprintf(&b, "parent_id: %s\n", yamlInt(attr.ParentID))
+
+	quotedTags := make([]string, len(attr.Tags))
+	for i, tag := range attr.Tags {
+		quotedTags[i] = strconv.Quote(tag)
+	}
+	fmt.Fprintf(&b, "tags: [%s]\n", strings.Join(quotedTags, ", "))
+
+	fmt.Fprintf(&b, "created_at: %s\n", yamlTime(attr.CreatedAt))
+	fmt.Fprintf(&b, "updated_at: %s\n", yamlTime(attr.UpdatedAt))
+	fmt.Fprintf(&b, "deleted_at: %s\n", yamlTime(attr.DeletedAt))
+	return b.String()
+}
+
+// yamlString returns str as a YAML double-quoted string. The escape
+// sequences of strconv.Quote are a subset of YAML's.
+func yamlString(str sql.NullString) string {
+	if !str.Valid {
+		return "null"
+	}
+	return strconv.Quote(str.String)
+}
+
+func yamlInt(i sql.NullInt64) string {
+	if !i.Valid {
+		return "null"
+	}
+	return strconv.FormatInt(i.Int64, 10)
+}
+
+// yamlFileMode returns permission bits in octal, e.g. 0644
+func yamlFileMode(mode sql.NullInt64) string {
+	if !mode.Valid {
+		return "null"
+	}
+	return fmt.Sprintf("%#o", mode.Int64)
+}
+
+func yamlTime(t eton.NullTime) string {
+	if !t.Valid {
+		return "null"
+	}
+	return t.Time.UTC().Format(frontMatterTimeLayout)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siadat/eton/eton"
+)
+
+// frontMatterTimeLayouts are the accepted timestamp layouts, the first one
+// is the one written by export
+var frontMatterTimeLayouts = []string{
+	frontMatterTimeLayout,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// noteMeta is the metadata of a note read from YAML front matter.
+type noteMeta struct {
+	ID        sql.NullInt64
+	Name      sql.NullString
+	Path      sql.NullString
+	Alias     sql.NullString
+	Mark      sql.NullInt64
+	ParentID  sql.NullInt64
+	Tags      []string
+	CreatedAt eton.NullTime
+	UpdatedAt eton.NullTime
+	DeletedAt eton.NullTime
+
+	FileMode       sql.NullInt64
+	FileModifiedAt eton.NullTime
+	MimeType       sql.NullString
+}
+
+// splitFrontMatter splits content into its front matter, without the "---"
+// lines, and the rest. hasFrontMatter is false if content does not start
+// with a front matter block.
+func splitFrontMatter(content string) (frontMatter, body string, hasFrontMatter bool) {
+	if !strings.HasPrefix(content, "---\n") {
+		return "", content, false
+	}
+	if strings.HasPrefix(content, "---\n---\n") {
+		return "", content[8:], true
+	}
+
+	end := strings.Index(content[3:], "\n---\n")
+	if end == -1 {
+		if strings.HasSuffix(content, "\n---") {
+			return content[4 : len(content)-3], "", true
+		}
+		return "", content, false
+	}
+	end += 3
+	return content[4 : end+1], content[end+5:], true
+}
+
+// parseFrontMatter reads the subset of YAML written by export: one
+// "key: value" per line, where value is null, a number, a string or a list
+// of strings. Lists may also be written as "- item" lines under the key.
+// Unknown keys are ignored.
+func parseFrontMatter(frontMatter string) (meta noteMeta, err error) {
+	var listKey string
+
+	for i, line := range strings.Split(frontMatter, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- ") && len(listKey) > 0 {
+			item, err := parseYAMLString(strings.TrimSpace(trimmed[2:]))
+			if err != nil {
+				return meta, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			if listKey == "tags" {
+				meta.Tags = append(meta.Tags, item)
+			}
+			continue
+		}
+
+		colon := strings.Index(line, ":")
+		if colon == -1 {
+			return meta, fmt.Errorf("line %d: expected \"key: value\"", i+1)
+		}
+		key := strings.TrimSpace(line[:colon])
+		value := strings.TrimSpace(line[colon+1:])
+
+		listKey = ""
+		if len(value) == 0 {
+			// a block list may follow
+			listKey = key
+			continue
+		}
+
+		if err = meta.set(key, value); err != nil {
+			return meta, fmt.Errorf("line %d: %s: %v", i+1, key, err)
+		}
+	}
+	return meta, nil
+}
+
+func (meta *noteMeta) set(key, value string) (err error) {
+	switch key {
+	case "id":
+		meta.ID, err = parseYAMLInt(value)
+	case "name":
+		meta.Name, err = parseYAMLNullString(value)
+	case "path":
+		meta.Path, err = parseYAMLNullString(value)
+	case "alias":
+		meta.Alias, err = parseYAMLNullString(value)
+	case "mark":
+		meta.Mark, err = parseYAMLInt(value)
+	case "parent_id":
+		meta.ParentID, err = parseYAMLInt(value)
+	case "tags":
+		meta.Tags, err = parseYAMLList(value)
+	case "created_at":
+		meta.CreatedAt, err = parseYAMLTime(value)
+	case "updated_at":
+		meta.UpdatedAt, err = parseYAMLTime(value)
+	case "deleted_at":
+		meta.DeletedAt, err = parseYAMLTime(value)
+	case "file_mode":
+		meta.FileMode, err = parseYAMLFileMode(value)
+	case "file_modified_at":
+		meta.FileModifiedAt, err = parseYAMLTime(value)
+	case "mime_type":
+		meta.MimeType, err = parseYAMLNullString(value)
+	}
+	return err
+}
+
+func isYAMLNull(value string) bool {
+	return value == "null" || value == "~"
+}
+
+func parseYAMLString(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		return strings.Replace(value[1:len(value)-1], "''", "'", -1), nil
+	}
+	return value, nil
+}
+
+func parseYAMLNullString(value string) (sql.NullString, error) {
+	if isYAMLNull(value) {
+		return sql.NullString{}, nil
+	}
+	str, err := parseYAMLString(value)
+	return sql.NullString{String: str, Valid: err == nil}, err
+}
+
+func parseYAMLInt(value string) (sql.NullInt64, error) {
+	if isYAMLNull(value) {
+		return sql.NullInt64{}, nil
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	return sql.NullInt64{Int64: i, Valid: err == nil}, err
+}
+
+// parseYAMLFileMode parses permission bits, in octal if they start with 0
+func parseYAMLFileMode(value string) (sql.NullInt64, error) {
+	if isYAMLNull(value) {
+		return sql.NullInt64{}, nil
+	}
+	mode, err := strconv.ParseInt(value, 0, 64)
+	if err == nil && (mode < 0 || mode > 0777) {
+		err = fmt.Errorf("invalid file mode %s", value)
+	}
+	return sql.NullInt64{Int64: mode, Valid: err == nil}, err
+}
+
+func parseYAMLTime(value string) (eton.NullTime, error) {
+	if isYAMLNull(value) {
+		return eton.NullTime{}, nil
+	}
+	value, err := parseYAMLString(value)
+	if err != nil {
+		return eton.NullTime{}, err
+	}
+	for _, layout := range frontMatterTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return eton.NullTime{Time: t, Valid: true}, nil
+		}
+	}
+	return eton.NullTime{}, fmt.Errorf("invalid time %s", value)
+}
+
+// parseYAMLList parses a flow list, e.g. [a, "b c"]
+func parseYAMLList(value string) (items []string, err error) {
+	if isYAMLNull(value) {
+		return nil, nil
+	}
+	if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("expected a list, got %s", value)
+	}
+
+	value = strings.TrimSpace(value[1 : len(value)-1])
+	for len(value) > 0 {
+		var item string
+		if value[0] == '"' || value[0] == '\'' {
+			// find the closing quote, skipping escaped characters
+			end := 1
+			for end < len(value) && value[end] != value[0] {
+				if value[0] == '"' && value[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(value) {
+				return nil, fmt.Errorf("unterminated string %s", value)
+			}
+			if item, err = parseYAMLString(value[:end+1]); err != nil {
+				return nil, err
+			}
+			value = strings.TrimSpace(value[end+1:])
+		} else {
+			end := strings.Index(value, ",")
+			if end == -1 {
+				end = len(value)
+			}
+			item = strings.TrimSpace(value[:end])
+			value = value[end:]
+		}
+
+		items = append(items, item)
+		value = strings.TrimPrefix(value, ",")
+		value = strings.TrimSpace(value)
+	}
+	return items, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/siadat/eton/eton"
+)
+
+func TestFrontMatterRoundTrip(t *testing.T) {
+	created := time.Date(2026, 1, 31, 10, 30, 0, 0, time.UTC)
+	var attr attrStruct
+	attr.ID = sql.NullInt64{Int64: 12, Valid: true}
+	attr.Name = sql.NullString{String: "file", Valid: true}
+	attr.ValueText = sql.NullString{String: "/tmp/a \"quoted\"\tpath", Valid: true}
+	attr.Alias = sql.NullString{String: "it's: tricky", Valid: true}
+	attr.Mark = sql.NullInt64{Int64: 1, Valid: true}
+	attr.ParentID = sql.NullInt64{Int64: 3, Valid: true}
+	attr.Tags = []string{"work", "a, b", `say "hi"`}
+	attr.CreatedAt = eton.NullTime{Time: created, Valid: true}
+	attr.FileMode = sql.NullInt64{Int64: 0640, Valid: true}
+	attr.FileModifiedAt = eton.NullTime{Time: created.Add(time.Hour), Valid: true}
+	attr.MimeType = sql.NullString{String: "text/plain; charset=utf-8", Valid: true}
+
+	meta, err := parseFrontMatter(attr.frontMatter())
+	if err != nil {
+		t.Fatalf("parseFrontMatter:\n%s\n%v", attr.frontMatter(), err)
+	}
+
+	got := fmt.Sprint(meta.ID, meta.Name, meta.Path, meta.Alias, meta.Mark, meta.ParentID, meta.Tags,
+		meta.CreatedAt.Time, meta.UpdatedAt.Valid, meta.DeletedAt.Valid, meta.FileMode, meta.FileModifiedAt.Time, meta.MimeType)
+	want := fmt.Sprint(attr.ID, attr.Name, attr.ValueText, attr.Alias, attr.Mark, attr.ParentID, attr.Tags,
+		attr.CreatedAt.Time, false, false, attr.FileMode, attr.FileModifiedAt.Time, attr.MimeType)
+	if got != want {
+		t.Errorf("front matter round trip:\n%s\ngot  %s\nwant %s", attr.frontMatter(), got, want)
+	}
+}
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		content, frontMatter, body string
+		ok                         bool
+	}{
+		{"---\nid: 1\n---\nbody\n", "id: 1\n", "body\n", true},
+		{"---\n---\nbody", "", "body", true},
+		{"---\nid: 1\n---", "id: 1\n", "", true},
+		{"no front matter\n---\n", "", "no front matter\n---\n", false},
+		{"---\nunterminated\n", "", "---\nunterminated\n", false},
+	}
+	for _, test := range tests {
+		frontMatter, body, ok := splitFrontMatter(test.content)
+		if frontMatter != test.frontMatter || body != test.body || ok != test.ok {
+			t.Errorf("splitFrontMatter(%q) = %q, %q, %v, want %q, %q, %v", test.content, frontMatter, body, ok, test.frontMatter, test.body, test.ok)
+		}
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	meta, err := parseFrontMatter("# written by hand\nalias: 'it''s'\ntags:\n  - one\n  - \"two words\"\ncreated_at: 2026-01-31\nunknown: kept out\nmark: ~\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Alias.String != "it's" || fmt.Sprint(meta.Tags) != "[one two words]" || meta.CreatedAt.Time.Day() != 31 || meta.Mark.Valid {
+		t.Errorf("parseFrontMatter = %+v", meta)
+	}
+
+	for _, frontMatter := range []string{
+		"no colon",
+		"id: one",
+		"tags: [\"open",
+		"file_mode: 01777",
+		"created_at: yesterday",
+		`alias: "unterminated`,
+	} {
+		if _, err := parseFrontMatter(frontMatter); err == nil {
+			t.Errorf("parseFrontMatter(%q) did not fail", frontMatter)
+		}
+	}
+}
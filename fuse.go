@@ -0,0 +1,415 @@
+// +build linux darwin freebsd
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+	"github.com/siadat/eton/eton"
+)
+
+// etonFS exposes the attributes table as a tree of files:
+//
+//   <mountpoint>/<identifier>          notes listed by "eton ls -a"
+//   <mountpoint>/<identifier>.d/       the notes under a note, at any depth
+//   <mountpoint>/marked/<identifier>   notes listed by "eton ls -as"
+//   <mountpoint>/removed/<identifier>  notes listed by "eton ls -a --removed"
+//
+// Writing to a file updates the note, unless it was saved by someone else
+// since the file was opened, removing it removes the note. In file names,
+// "/" is written %2F and "%" is written %25.
+type etonFS struct {
+	store eton.Store
+	opts  options
+
+	// mu serializes database access, fuse requests are served concurrently
+	mu sync.Mutex
+}
+
+type dirNode struct {
+	fsys     *etonFS
+	opts     options
+	subdirs  map[string]*dirNode
+	readOnly bool
+
+	// tree exposes the notes under a note as a directory
+	tree bool
+}
+
+// childrenSuffix is appended to the file name of a note to name the
+// directory of the notes under it.
+const childrenSuffix = ".d"
+
+type fileNode struct {
+	fsys     *etonFS
+	dir      *dirNode
+	attr     attrStruct
+	readOnly bool
+
+	mu      sync.Mutex
+	content []byte
+	dirty   bool
+
+	// version is the version of the note when it was opened, or saved
+	version int64
+}
+
+var (
+	_ fs.HandleReadDirAller = (*dirNode)(nil)
+	_ fs.NodeStringLookuper = (*dirNode)(nil)
+	_ fs.NodeRemover        = (*dirNode)(nil)
+	_ fs.NodeOpener         = (*fileNode)(nil)
+	_ fs.HandleReadAller    = (*fileNode)(nil)
+	_ fs.HandleWriter       = (*fileNode)(nil)
+	_ fs.HandleFlusher      = (*fileNode)(nil)
+	_ fs.NodeFsyncer        = (*fileNode)(nil)
+	_ fs.NodeSetattrer      = (*fileNode)(nil)
+)
+
+// mount serves the database at opts.MountPoint until it is unmounted or
+// the process is interrupted.
+func mount(ctx context.Context, store eton.Store, opts options) error {
+	if err := os.MkdirAll(opts.MountPoint, 0700); err != nil {
+		return err
+	}
+
+	c, err := fuse.Mount(opts.MountPoint, fuse.FSName("eton"), fuse.Subtype("etonfs"))
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// CTRL-c unmounts, which makes fs.Serve return
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		fuse.Unmount(opts.MountPoint)
+	}()
+
+	opts.Offset = 0
+	opts.Limit = -1
+	opts.Filters = nil
+	return fs.Serve(c, &etonFS{store: store, opts: opts})
+}
+
+func (fsys *etonFS) Root() (fs.Node, error) {
+	marked := fsys.opts
+	marked.ShortMode = true
+
+	removed := fsys.opts
+	removed.IncludeRemoved = true
+
+	return &dirNode{
+		fsys: fsys,
+		opts: fsys.opts,
+		tree: true,
+		subdirs: map[string]*dirNode{
+			"marked":  {fsys: fsys, opts: marked},
+			"removed": {fsys: fsys, opts: removed, readOnly: true},
+		},
+	}, nil
+}
+
+// list returns the notes of the directory keyed by their file name, and
+// the notes with notes under them keyed by the name of their directory.
+func (d *dirNode) list(ctx context.Context) (files, dirs map[string]attrStruct, err error) {
+	d.fsys.mu.Lock()
+	defer d.fsys.mu.Unlock()
+
+	listed, err := listNotes(ctx, d.fsys.store, d.opts)
+	if err != nil {
+		log.Println(err)
+		return nil, nil, fuse.EIO
+	}
+
+	files = make(map[string]attrStruct)
+	dirs = make(map[string]attrStruct)
+	for _, attr := range listed {
+		name := fileName(attr)
+		if _, ok := d.subdirs[name]; !ok {
+			// a subdirectory shadows a note with the same alias
+			files[name] = attr
+		}
+
+		if !d.tree {
+			continue
+		}
+		count, err := d.fsys.store.CountChildren(ctx, attr.getID())
+		if err != nil {
+			log.Println(err)
+			return nil, nil, fuse.EIO
+		}
+		if count > 0 {
+			dirs[name+childrenSuffix] = attr
+		}
+	}
+
+	for name := range dirs {
+		// notes shadow the directories of other notes
+		if _, ok := files[name]; ok {
+			delete(dirs, name)
+		}
+	}
+	return files, dirs, nil
+}
+
+// childDir returns the directory of the notes under attr.
+func (d *dirNode) childDir(attr attrStruct) *dirNode {
+	opts := d.opts
+	opts.RootID = attr.getID()
+	return &dirNode{fsys: d.fsys, opts: opts, readOnly: d.readOnly, tree: true}
+}
+
+var fileNameReplacer = strings.NewReplacer("%", "%25", "/", "%2F")
+
+// fileName returns the identifier of a note, escaped to be a valid file name.
+func fileName(attr attrStruct) string {
+	name := fileNameReplacer.Replace(attr.getIdentifier())
+	if name == "." || name == ".." {
+		name = strings.Replace(name, ".", "%2E", -1)
+	}
+	return name
+}
+
+func (d *dirNode) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0755
+	if d.readOnly {
+		a.Mode = os.ModeDir | 0555
+	}
+	return nil
+}
+
+func (d *dirNode) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	var dirents []fuse.Dirent
+	for name := range d.subdirs {
+		dirents = append(dirents, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+	}
+	files, dirs, err := d.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for name := range files {
+		dirents = append(dirents, fuse.Dirent{Name: name, Type: fuse.DT_File})
+	}
+	for name := range dirs {
+		dirents = append(dirents, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+	}
+	return dirents, nil
+}
+
+func (d *dirNode) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	if subdir, ok := d.subdirs[name]; ok {
+		return subdir, nil
+	}
+
+	files, dirs, err := d.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if attr, ok := dirs[name]; ok {
+		return d.childDir(attr), nil
+	}
+	attr, ok := files[name]
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+
+	return &fileNode{
+		fsys:     d.fsys,
+		dir:      d,
+		attr:     attr,
+		readOnly: d.readOnly || len(attr.ValueBlob) > 0,
+		content:  []byte(attr.getValue()),
+	}, nil
+}
+
+func (d *dirNode) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	if d.readOnly || req.Dir {
+		return fuse.EPERM
+	}
+
+	files, _, err := d.list(ctx)
+	if err != nil {
+		return err
+	}
+	attr, ok := files[req.Name]
+	if !ok {
+		return fuse.ENOENT
+	}
+
+	d.fsys.mu.Lock()
+	defer d.fsys.mu.Unlock()
+	_, err = d.fsys.store.Remove(ctx, attr.getID(), false)
+	if errors.Is(err, eton.ErrHasChildren) {
+		return fuse.Errno(syscall.ENOTEMPTY)
+	}
+	if errors.Is(err, eton.ErrNotFound) {
+		return fuse.ENOENT
+	}
+	return err
+}
+
+func (f *fileNode) Attr(ctx context.Context, a *fuse.Attr) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	a.Mode = 0644
+	if f.readOnly {
+		a.Mode = 0444
+	}
+	a.Size = uint64(len(f.content))
+	a.Ctime = f.attr.getCreatedAt()
+	a.Mtime = f.attr.getUpdatedAt()
+	if a.Mtime.IsZero() {
+		a.Mtime = a.Ctime
+	}
+	return nil
+}
+
+func (f *fileNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	if f.readOnly && !req.Flags.IsReadOnly() {
+		return nil, fuse.EPERM
+	}
+	if err := f.reload(ctx); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	if !f.dirty {
+		f.version = f.attr.Version
+	}
+	f.mu.Unlock()
+
+	// the size of a note changes behind the kernel's back
+	resp.Flags |= fuse.OpenDirectIO
+	return f, nil
+}
+
+// reload reads the note again, unless it has unsaved writes, since it may
+// have been changed since it was looked up.
+func (f *fileNode) reload(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.dirty {
+		return nil
+	}
+
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	opts := f.dir.opts
+	opts.Filters = []string{fmt.Sprintf("id:%d", f.attr.getID())}
+	attrs, err := listNotes(ctx, f.fsys.store, opts)
+	if err != nil {
+		log.Println(err)
+		return fuse.EIO
+	}
+	if len(attrs) == 0 {
+		return fuse.ENOENT
+	}
+
+	f.attr = attrs[0]
+	f.content = []byte(f.attr.getValue())
+	return nil
+}
+
+func (f *fileNode) ReadAll(ctx context.Context) ([]byte, error) {
+	if err := f.reload(ctx); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.content, nil
+}
+
+func (f *fileNode) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if f.readOnly {
+		return fuse.EPERM
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	end := int(req.Offset) + len(req.Data)
+	if end > len(f.content) {
+		f.content = append(f.content, make([]byte, end-len(f.content))...)
+	}
+	copy(f.content[req.Offset:], req.Data)
+	f.dirty = true
+
+	resp.Size = len(req.Data)
+	return nil
+}
+
+func (f *fileNode) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if !req.Valid.Size() {
+		return nil
+	}
+	if f.readOnly {
+		return fuse.EPERM
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if int(req.Size) <= len(f.content) {
+		f.content = f.content[:req.Size]
+	} else {
+		f.content = append(f.content, make([]byte, int(req.Size)-len(f.content))...)
+	}
+	f.dirty = true
+	resp.Attr.Size = req.Size
+	return nil
+}
+
+func (f *fileNode) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	return f.save(ctx)
+}
+
+func (f *fileNode) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+	return f.save(ctx)
+}
+
+// save writes the content back to the database if it was modified.
+func (f *fileNode) save(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.dirty {
+		return nil
+	}
+
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	valueText := string(f.content)
+	version, err := f.fsys.store.UpdateIfVersion(ctx, f.attr.getID(), valueText, f.version)
+	if errors.Is(err, eton.ErrConflict) {
+		log.Printf("%s was saved by someone else since it was opened, not saved\n", f.attr.getIdentifier())
+		return fuse.EIO
+	}
+	if errors.Is(err, eton.ErrNotFound) {
+		return fuse.ENOENT
+	}
+	if err != nil {
+		return err
+	}
+	f.attr.ValueText = sql.NullString{String: valueText, Valid: true}
+	f.attr.Version, f.version = version, version
+	f.dirty = false
+	return nil
+}
@@ -0,0 +1,104 @@
+// +build linux darwin freebsd
+
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+func lookupFile(t *testing.T, ctx context.Context, dir fs.Node, name string) *fileNode {
+	t.Helper()
+	node, err := dir.(*dirNode).Lookup(ctx, name)
+	if err != nil {
+		t.Fatalf("Lookup(%s): %v", name, err)
+	}
+	file, ok := node.(*fileNode)
+	if !ok {
+		t.Fatalf("Lookup(%s) = %T, want a file", name, node)
+	}
+	return file
+}
+
+func TestFuseChildDirectories(t *testing.T) {
+	ctx, store := openTestStore(t)
+	parent := createNote(t, ctx, store, "project", "proj")
+	child, err := store.CreateNote(ctx, "task", parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.SetAlias(ctx, child, "task"); err != nil {
+		t.Fatal(err)
+	}
+
+	root, _ := (&etonFS{store: store, opts: options{RootID: -1, Limit: -1}}).Root()
+	dirents, err := root.(*dirNode).ReadDirAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, dirent := range dirents {
+		names = append(names, dirent.Name)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, " "); got != "marked proj proj.d removed" {
+		t.Errorf("root lists %s, want marked proj proj.d removed", got)
+	}
+
+	dir, err := root.(*dirNode).Lookup(ctx, "proj.d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := lookupFile(t, ctx, dir, "task").ReadAll(ctx); err != nil || string(content) != "task" {
+		t.Errorf("proj.d/task = %q, %v, want task", content, err)
+	}
+	if _, err = root.(*dirNode).Lookup(ctx, "task"); err != fuse.ENOENT {
+		t.Errorf("Lookup(task) at the top level = %v, want ENOENT", err)
+	}
+}
+
+func TestFuseSaveConflict(t *testing.T) {
+	ctx, store := openTestStore(t)
+	id := createNote(t, ctx, store, "first", "note")
+	root, _ := (&etonFS{store: store, opts: options{RootID: -1, Limit: -1}}).Root()
+
+	write := func(file *fileNode, text string) error {
+		if _, err := file.Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenReadWrite}, &fuse.OpenResponse{}); err != nil {
+			return err
+		}
+		if err := file.Setattr(ctx, &fuse.SetattrRequest{Valid: fuse.SetattrSize}, &fuse.SetattrResponse{}); err != nil {
+			return err
+		}
+		if err := file.Write(ctx, &fuse.WriteRequest{Data: []byte(text)}, &fuse.WriteResponse{}); err != nil {
+			return err
+		}
+		return file.Flush(ctx, &fuse.FlushRequest{})
+	}
+
+	mine := lookupFile(t, ctx, root, "note")
+	if _, err := mine.Open(ctx, &fuse.OpenRequest{Flags: fuse.OpenReadWrite}, &fuse.OpenResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(lookupFile(t, ctx, root, "note"), "theirs"); err != nil {
+		t.Fatal(err)
+	}
+
+	// opened before the other save
+	mine.Write(ctx, &fuse.WriteRequest{Data: []byte("mine!")}, &fuse.WriteResponse{})
+	if err := mine.Flush(ctx, &fuse.FlushRequest{}); err != fuse.EIO {
+		t.Errorf("saving a note saved since it was opened = %v, want EIO", err)
+	}
+
+	attr, err := store.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr.ValueText.String != "theirs" {
+		t.Errorf("note = %q, want theirs", attr.ValueText.String)
+	}
+}
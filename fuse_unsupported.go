@@ -0,0 +1,15 @@
+// +build !linux,!darwin,!freebsd
+
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+
+	"github.com/siadat/eton/eton"
+)
+
+func mount(ctx context.Context, store eton.Store, opts options) error {
+	return errors.New("mount is not supported on " + runtime.GOOS)
+}
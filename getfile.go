@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/siadat/eton/eton"
+)
+
+// defaultFileMode is the mode of files added before their mode was stored
+const defaultFileMode = 0600
+
+// cmdGetFile writes a file added with "eton addfile" to dest, to the
+// current directory under its original name if dest is empty, or to its
+// original path with --to-original.
+func cmdGetFile(ctx context.Context, store eton.Store, opts options) bool {
+	attr := findAttributeFromOpts(ctx, store, opts)
+	if !attr.isFile() {
+		log.Fatalf("%s is not a file, use eton cat to print notes", attr.getIdentifier())
+	}
+
+	original := attr.getTextValue()
+	dest := opts.Dest
+	switch {
+	case opts.ToOriginal:
+		dest = original
+	case len(dest) == 0:
+		dest = filepath.Base(original)
+	default:
+		if info, err := os.Stat(dest); err == nil && info.IsDir() {
+			dest = filepath.Join(dest, filepath.Base(original))
+		}
+	}
+
+	if err := attr.writeFile(dest, opts.Force); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s written, %s\n", dest, formatSize(int64(len(attr.ValueBlob))))
+	return true
+}
+
+// mimeType returns the MIME type of a file, detected now for the files
+// added before it was stored.
+func (attr attrStruct) mimeType() string {
+	if attr.MimeType.Valid {
+		return attr.MimeType.String
+	}
+	return eton.DetectMimeType(attr.getTextValue(), attr.ValueBlob)
+}
+
+// isBinary reports whether attr is a file that is not text.
+func (attr attrStruct) isBinary() bool {
+	return attr.isFile() && !eton.IsTextMimeType(attr.mimeType())
+}
+
+// prettyFileInfo returns the type and size of a file, for listings.
+func (attr attrStruct) prettyFileInfo() string {
+	if !attr.isFile() {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(attr.mimeType())
+	if err != nil {
+		mediaType = attr.mimeType()
+	}
+	return " " + color(fmt.Sprintf("(%s, %s)", mediaType, formatSize(int64(len(attr.ValueBlob)))), themeColor("context"))
+}
+
+// content returns the exact bytes of attr's value, decrypted if needed.
+func (attr attrStruct) content(opts options) []byte {
+	if attr.isEncrypted() {
+		return []byte(attr.decryptedValue(opts))
+	}
+	if attr.isFile() {
+		return attr.ValueBlob
+	}
+	return []byte(attr.getValue())
+}
+
+// writeFile writes the exact content of a file added with addfile to path,
+// with its permission bits and modification time. An existing file is only
+// overwritten if overwrite is true, or if it has the same content.
+func (attr attrStruct) writeFile(path string, overwrite bool) error {
+	mode := os.FileMode(defaultFileMode)
+	if attr.FileMode.Valid {
+		mode = os.FileMode(attr.FileMode.Int64).Perm()
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	current, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		// fails if it was created meanwhile
+		flag |= os.O_EXCL
+	case err != nil:
+		return err
+	case !overwrite && !bytes.Equal(current, attr.ValueBlob):
+		return fmt.Errorf("%s exists and differs from %s, use --force to overwrite it", path, attr.getIdentifier())
+	}
+
+	f, err := os.OpenFile(path, flag, mode)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(attr.ValueBlob); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	// the umask applies to new files, and existing files keep their mode
+	if err = os.Chmod(path, mode); err != nil {
+		return err
+	}
+	if attr.FileModifiedAt.Valid {
+		return os.Chtimes(path, time.Now(), attr.FileModifiedAt.Time)
+	}
+	return nil
+}
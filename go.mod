@@ -3,11 +3,13 @@ module github.com/siadat/eton
 go 1.15
 
 require (
+	bazil.org/fuse v0.0.0-20200524192727-fb710f7dfd05
 	github.com/andrew-d/go-termutil v0.0.0-20150726205930-009166a695a2
 	github.com/docopt/docopt-go v0.0.0-20180111231733-ee0de3bc6815
 	github.com/fsnotify/fsnotify v1.4.9 // indirect
 	github.com/mattn/go-colorable v0.1.8
 	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/mgutz/ansi v0.0.0-20200706080929-d51e80ef957d
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 	gopkg.in/fsnotify.v1 v1.4.7
 )
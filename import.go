@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/siadat/eton/eton"
+)
+
+const (
+	importCreate = "create"
+	importUpdate = "update"
+	importSkip   = "skip"
+)
+
+// importItem is a file to import and what importing it does.
+type importItem struct {
+	Path   string
+	Action string
+	Reason string // why it is skipped
+
+	Meta     noteMeta
+	Body     string
+	Blob     []byte
+	Existing attrStruct // the note updated by the import
+}
+
+// planImport decides for every file in dir whether it creates a note,
+// updates an existing one or is skipped. Notes are matched by the id in
+// their front matter first, then by alias. Files without either, e.g. plain
+// Markdown, are matched by their content, so that importing them again does
+// not duplicate them. Files written by export as <id>-<filename> with a .yml
+// sidecar are imported as files.
+func planImport(ctx context.Context, store eton.Store, dir string) (items []importItem, err error) {
+	byID := make(map[int64]attrStruct)
+	byAlias := make(map[string]attrStruct)
+	byContent := make(map[[sha256.Size]byte]attrStruct)
+	for _, attr := range listAllAttributes(ctx, store) {
+		byID[attr.getID()] = attr
+		if alias := attr.getAlias(); len(alias) > 0 {
+			byAlias[alias] = attr
+		}
+		if !attr.isFile() && !attr.isEncrypted() && !attr.DeletedAt.Valid {
+			byContent[sha256.Sum256([]byte(attr.getTextValue()))] = attr
+		}
+	}
+
+	// the blobs described by a sidecar are not notes themselves
+	sidecars := make(map[string]bool)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && strings.HasSuffix(path, ".yml") {
+			if _, err := os.Stat(strings.TrimSuffix(path, ".yml")); err == nil {
+				sidecars[strings.TrimSuffix(path, ".yml")] = true
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plannedAliases := make(map[string]string)
+	plannedIDs := make(map[int64]bool)
+	plannedContent := make(map[[sha256.Size]byte]string)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && path != dir {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || sidecars[path] {
+			return nil
+		}
+
+		item := importItem{Path: path}
+		if sidecars[strings.TrimSuffix(path, ".yml")] && strings.HasSuffix(path, ".yml") {
+			item.Path = strings.TrimSuffix(path, ".yml")
+			item.readFile(path)
+		} else {
+			item.readNote()
+		}
+
+		if item.Action != importSkip {
+			item.match(byID, byAlias, byContent)
+		}
+
+		if item.Action == importCreate {
+			// two files may not create notes with the same alias or ID
+			if other, taken := plannedAliases[item.Meta.Alias.String]; taken && item.Meta.Alias.Valid {
+				item.skip(fmt.Sprintf("alias \"%s\" is used by %s", item.Meta.Alias.String, other))
+			} else if item.Meta.Alias.Valid {
+				plannedAliases[item.Meta.Alias.String] = item.Path
+			}
+			if plannedIDs[item.Meta.ID.Int64] && item.Meta.ID.Valid {
+				item.Meta.ID = sql.NullInt64{}
+			}
+			plannedIDs[item.Meta.ID.Int64] = true
+		}
+
+		if item.Action == importCreate && item.matchesContent() {
+			// nor two files without id or alias with the same content
+			sum := sha256.Sum256([]byte(item.Body))
+			if other, taken := plannedContent[sum]; taken {
+				item.skip("same content as " + other)
+			} else {
+				plannedContent[sum] = item.Path
+			}
+		}
+		items = append(items, item)
+		return nil
+	})
+	return items, err
+}
+
+// readNote reads a text file, with or without front matter.
+func (item *importItem) readNote() {
+	content, err := ioutil.ReadFile(item.Path)
+	if err != nil {
+		item.skip(err.Error())
+		return
+	}
+	if !utf8.Valid(content) || bytes.IndexByte(content, 0) != -1 {
+		item.skip("not a text file")
+		return
+	}
+
+	frontMatter, body, hasFrontMatter := splitFrontMatter(string(content))
+	if hasFrontMatter {
+		if item.Meta, err = parseFrontMatter(frontMatter); err != nil {
+			item.skip("invalid front matter: " + err.Error())
+			return
+		}
+	}
+	item.Body = body
+}
+
+// readFile reads a file exported with its sidecar metadata.
+func (item *importItem) readFile(sidecar string) {
+	frontMatter, err := ioutil.ReadFile(sidecar)
+	if err != nil {
+		item.skip(err.Error())
+		return
+	}
+	if item.Meta, err = parseFrontMatter(string(frontMatter)); err != nil {
+		item.skip("invalid metadata: " + err.Error())
+		return
+	}
+	if item.Blob, err = ioutil.ReadFile(item.Path); err != nil {
+		item.skip(err.Error())
+		return
+	}
+	if !item.Meta.Path.Valid && !eton.IsEncrypted(item.Blob) {
+		item.Meta.Path.String, item.Meta.Path.Valid = item.Path, true
+	}
+}
+
+func (item *importItem) skip(reason string) {
+	item.Action = importSkip
+	item.Reason = reason
+}
+
+// matchesContent reports whether item is matched to a note by its content,
+// because it has no id or alias.
+func (item importItem) matchesContent() bool {
+	return item.Blob == nil && !item.Meta.ID.Valid && !item.Meta.Alias.Valid
+}
+
+// match finds the note updated by item, if any.
+func (item *importItem) match(byID map[int64]attrStruct, byAlias map[string]attrStruct, byContent map[[sha256.Size]byte]attrStruct) {
+	existing, found := byID[item.Meta.ID.Int64]
+	if !found || !item.Meta.ID.Valid {
+		existing, found = byAlias[item.Meta.Alias.String]
+		found = found && item.Meta.Alias.Valid
+	}
+	if !found && item.matchesContent() {
+		existing, found = byContent[sha256.Sum256([]byte(item.Body))]
+	}
+
+	if !found {
+		item.Action = importCreate
+		if _, taken := byID[item.Meta.ID.Int64]; taken {
+			// keep the ID only if it is free
+			item.Meta.ID = sql.NullInt64{}
+		}
+		return
+	}
+
+	item.Existing = existing
+	if other, taken := byAlias[item.Meta.Alias.String]; taken && other.getID() != existing.getID() {
+		item.skip(fmt.Sprintf("alias \"%s\" belongs to ID:%d", item.Meta.Alias.String, other.getID()))
+		return
+	}
+
+	if item.isUnchanged() {
+		item.skip("unchanged")
+		return
+	}
+	item.Action = importUpdate
+}
+
+// isUnchanged reports whether importing item would not modify the note.
+func (item importItem) isUnchanged() bool {
+	attr := item.Existing
+	if item.Blob != nil {
+		if !bytes.Equal(item.Blob, attr.ValueBlob) {
+			return false
+		}
+	} else if item.Body != attr.getTextValue() {
+		return false
+	}
+
+	if item.Meta.Alias.Valid && item.Meta.Alias.String != attr.getAlias() {
+		return false
+	}
+	if item.Meta.Mark.Valid && item.Meta.Mark.Int64 != attr.Mark.Int64 {
+		return false
+	}
+	if item.Meta.ParentID != attr.ParentID && item.Meta.ID.Valid {
+		return false
+	}
+
+	tags := make(map[string]bool)
+	for _, tag := range attr.Tags {
+		tags[tag] = true
+	}
+	for _, tag := range item.Meta.Tags {
+		if !tags[eton.NormalizeTag(tag)] {
+			return false
+		}
+	}
+	return true
+}
+
+// apply creates or updates the note of item.
+func (item importItem) apply(ctx context.Context, store eton.Store) {
+	var id int64
+	var err error
+
+	switch item.Action {
+	case importCreate:
+		attr := eton.Attr{
+			ID:        item.Meta.ID,
+			Name:      sql.NullString{String: "note", Valid: true},
+			Alias:     item.Meta.Alias,
+			Mark:      item.Meta.Mark,
+			ParentID:  item.Meta.ParentID,
+			ValueText: sql.NullString{String: item.Body, Valid: true},
+			CreatedAt: item.Meta.CreatedAt,
+			UpdatedAt: item.Meta.UpdatedAt,
+			DeletedAt: item.Meta.DeletedAt,
+		}
+		if item.Blob != nil {
+			attr.Name.String, attr.ValueText, attr.ValueBlob = "file", item.Meta.Path, item.Blob
+			if item.Meta.Name.Valid {
+				attr.Name = item.Meta.Name
+			}
+			attr.FileMode, attr.FileModifiedAt, attr.MimeType = item.Meta.FileMode, item.Meta.FileModifiedAt, item.Meta.MimeType
+			if !attr.MimeType.Valid && !eton.IsEncrypted(item.Blob) {
+				attr.MimeType.String, attr.MimeType.Valid = eton.DetectMimeType(item.Path, item.Blob), true
+			}
+		}
+
+		id, err = store.Insert(ctx, attr)
+		check(err)
+	case importUpdate:
+		attr := item.Existing
+		id = attr.getID()
+
+		if item.Blob != nil {
+			_, err = store.UpdateBlob(ctx, id, item.Blob)
+			check(err)
+		} else if item.Body != attr.getTextValue() {
+			updateNote(ctx, store, id, item.Body)
+		}
+
+		if item.Meta.Alias.Valid && item.Meta.Alias.String != attr.getAlias() {
+			_, err = store.SetAlias(ctx, id, item.Meta.Alias.String)
+			check(err)
+		}
+		if item.Meta.Mark.Valid && item.Meta.Mark.Int64 != attr.Mark.Int64 && !attr.DeletedAt.Valid {
+			_, err = store.SetMark(ctx, id, int(item.Meta.Mark.Int64))
+			check(err)
+		}
+		if item.Meta.ID.Valid && item.Meta.ParentID != attr.ParentID {
+			parentID := item.Meta.ParentID.Int64
+			if !item.Meta.ParentID.Valid {
+				parentID = -1
+			}
+			_, err = store.SetParent(ctx, id, parentID)
+			check(err)
+		}
+	default:
+		return
+	}
+
+	_, err = store.AddTags(ctx, id, item.Meta.Tags)
+	check(err)
+}
+
+// describe returns a line of the import report.
+func (item importItem) describe() string {
+	switch item.Action {
+	case importCreate:
+		return fmt.Sprintf("%s\t%s", color(importCreate, "green"), item.Path)
+	case importUpdate:
+		return fmt.Sprintf("%s\t%s\t%s", color(importUpdate, "yellow"), item.Path, item.Existing.getIdentifier())
+	}
+	return fmt.Sprintf("%s\t%s\t%s", color(importSkip, "black"), item.Path, item.Reason)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportPlainMarkdownTwice(t *testing.T) {
+	ctx, store := openTestStore(t)
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"plain.md":  "# groceries\nmilk\n",
+		"copy.md":   "# groceries\nmilk\n",
+		"tagged.md": "---\ntags: [ops]\n---\nps aux\n",
+		"alias.md":  "---\nalias: procs\n---\nps aux\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	importDir := func() (actions map[string]string) {
+		items, err := planImport(ctx, store, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actions = make(map[string]string)
+		for _, item := range items {
+			item.apply(ctx, store)
+			actions[filepath.Base(item.Path)] = item.Action
+		}
+		return actions
+	}
+
+	first := importDir()
+	if first["plain.md"] == first["copy.md"] || first["tagged.md"] != importCreate || first["alias.md"] != importCreate {
+		t.Errorf("first import = %v, want one of the copies skipped and the others created", first)
+	}
+	count, err := store.Count(ctx)
+	if err != nil || count != 3 {
+		t.Fatalf("%d notes after the first import, %v, want 3", count, err)
+	}
+
+	for name, action := range importDir() {
+		if action != importSkip {
+			t.Errorf("importing %s again = %s, want skip", name, action)
+		}
+	}
+	if count, err = store.Count(ctx); err != nil || count != 3 {
+		t.Errorf("%d notes after the second import, %v, want 3", count, err)
+	}
+}
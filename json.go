@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// printJSON writes attrs as a JSON array, or as JSON Lines, one object per
+// line, if lines is true.
+func printJSON(w io.Writer, attrs []attrStruct, lines bool) {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	if lines {
+		for _, attr := range attrs {
+			check(encoder.Encode(attr))
+		}
+		return
+	}
+
+	// attrStruct is marshalled by eton.Attr's MarshalJSON
+	if attrs == nil {
+		attrs = []attrStruct{}
+	}
+	check(encoder.Encode(attrs))
+}
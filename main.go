@@ -2,53 +2,104 @@ package main
 
 import (
 	"bufio"
-	"database/sql"
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/docopt/docopt-go"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/siadat/eton/eton"
 )
 
 var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
-const dbfilename string = ".etondb"
-
 const usage string = `Usage:
-    eton new [-|<note>] [-v]
-    eton (ls|grep) [<filters>...] [-asli] [-o OFFSET] [-L LIMIT] [--after AFTER] [--removed]
-    eton edit [<ids>...] [-v]
+    eton new [-|<note>] [-v] [-p PARENT] [--encrypt] [--key-file FILE]
+    eton ls [<filters>...] [-asrli] [-o OFFSET] [-L LIMIT] [--after AFTER] [--removed] [--json|--jsonl] [--since WHEN] [--until WHEN] [--created WHEN] [--updated WHEN] [--sort ORDER]
+    eton grep [<filters>...] [-asrliEIwcn] [-o OFFSET] [-L LIMIT] [--after AFTER] [--removed] [--json|--jsonl] [--since WHEN] [--until WHEN] [--created WHEN] [--updated WHEN] [--sort ORDER]
+    eton browse [<filters>...] [-s] [--removed] [--sort ORDER] [--key-file FILE]
+    eton edit [<ids>...] [-v] [--key-file FILE]
     eton alias <id1> <id2>
     eton unalias <alias>
     eton mark <ids>...
     eton unmark <ids>...
-    eton cat [<ids>...]
-    eton show [<ids>...]
-    eton (rm|remove) <ids>...
-    eton (unrm|unremove|recover) <ids>...
+    eton tag <id> <tags>...
+    eton untag <id> <tags>...
+    eton tags
+    eton backlinks <id>
+    eton cat [<ids>...] [--json|--jsonl] [--key-file FILE]
+    eton show [<ids>...] [--json|--jsonl] [--key-file FILE]
+    eton encrypt <id> [--key-file FILE]
+    eton (rm|remove) <ids>... [-r]
+    eton (unrm|unremove|recover) <ids>... [-r]
+    eton (mv|move) <ids>... [-p PARENT]
+    eton trash
+    eton purge [<ids>...] [--older-than WHEN] [-fv]
     eton addfile (-|<file>...)
-    eton mount [<mountpoint>]
+    eton getfile <id> [<dest>] [--to-original] [-fv]
+    eton restore <id> [-fv]
+    eton export [--format FORMAT] <dir> [-v]
+    eton import <dir> [--dry-run] [-v]
+    eton log <id>
+    eton diff <id> [<rev1>] [<rev2>]
+    eton revert <id> <rev>
+    eton mount [<mountpoint>] [-v]
+    eton gc-tmp [-v]
+    eton serve [--listen ADDR] [--token TOKEN] [-v]
+    eton notebooks
+    eton config list
+    eton config get <key>
+    eton config set <key> <value>
+
+Global options, given before the command, e.g. "eton -n work ls":
+    --db FILE            database file, defaults to $ETON_DB or $XDG_DATA_HOME/eton/eton.db
+    -n NOTEBOOK          use the database of a notebook defined in the config file
+    --no-track           do not count accesses to notes, which rank them by frecency
 
 Options:
     -A, --after AFTER    lines to print after a match [default: 0]
     -o, --offset OFFSET  offset for the items listed [default: 0]
-    -L, --limit LIMIT    maximum number of rows returned, pass -Lall to list everything [default: 10]
-    -r, --recursive      recursive mode
+    -L, --limit LIMIT    maximum number of rows returned, pass -Lall to list everything, defaults to the limit in the config file or 10
+    -r, --recursive      recursive mode, list or remove notes with the notes under them
+    -p, --parent PARENT  id or alias of the parent note, top level if omitted
     -l, --list-files     list items as filenames
-    -i, --list-ids       list items as ids
+    -i, --list-ids       list items as ids, grep -i is --ignore-case
+    -E, --regexp         grep filters are regular expressions
+    -I, --ignore-case    grep ignores case, also -i in grep
+    -w, --word-regexp    grep only matches whole words
+    -c, --count          grep prints the number of matching lines of each item
+    -n, --line-number    grep prints the line numbers of matching lines
     -s, --short          short mode lists rows with aliases only
     -v, --verbose        talk a lot
     -a, --all            list all items, alias for --limit -1
     --removed            only removed items
+    --since WHEN         only items modified since a date, e.g. 2026-01-31, or an age, e.g. 3d or 2w
+    --until WHEN         only items modified before the end of a date, or before an age
+    --created WHEN       only items created on a date or within an age, compare with > or <, e.g. '>2w', like created:WHEN
+    --updated WHEN       like --created for the modification time, e.g. '>1y' for items untouched for a year
+    --sort ORDER         frecency, the default, updated, created, accessed, frequency or alias
+    --older-than WHEN    only purge items removed before an age, e.g. 30d, or a date
+    --json               print items as a JSON array
+    --jsonl              print items as JSON Lines, one object per line
+    --format FORMAT      export format, only md is supported [default: md]
+    --dry-run            report what would be done without doing it
+    --to-original        write a file to the path it was added from
+    -f, --force          overwrite existing files, or purge every removed note without asking
+    --encrypt            encrypt the note with a passphrase or the key file
+    --key-file FILE      file with a 32-byte key used instead of a passphrase, defaults to $ETON_KEY_FILE
+    --listen ADDR        address of the HTTP API [default: 127.0.0.1:8080]
+    --token TOKEN        require "Authorization: Bearer TOKEN", defaults to $ETON_TOKEN or a random one
 `
 
 func main() {
-	args, err := docopt.Parse(usage, nil, true, "version 0.0.0", false, false)
+	argv, g := globalOptions(os.Args[1:])
+	argv = grepOptions(argv)
+	args, err := docopt.Parse(usage, argv, true, "version 0.0.0", false, false)
 
 	if err != nil || len(args) == 0 {
 		editor := os.Getenv("EDITOR")
@@ -63,31 +114,48 @@ func main() {
 		os.Exit(1)
 	}
 
+	cfg = loadConfig()
 	opts := optionsFromArgs(args)
 
-	dbfile := filepath.Join(homeDir(), dbfilename)
-	var db *sql.DB
+	// the config file does not need the database
+	if args["config"].(bool) {
+		cmdConfig(args)
+		return
+	}
+
+	dbfile := databasePath(g.db, g.notebook, cfg)
+	ctx := context.Background()
 
 	dbfileExists := false
 
 	if _, err = os.Stat(dbfile); err == nil {
 		dbfileExists = true
+	} else {
+		check(os.MkdirAll(filepath.Dir(dbfile), 0700))
 	}
 
-	//if dbfileExists || args["init"].(bool) {
-	if true {
-		var err error
-		db, err = sql.Open("sqlite3", dbfile)
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer db.Close()
-	} else {
-		log.Fatal(`database file not found, use "init" command`)
+	store, err := eton.Open(ctx, dbfile)
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer store.Close()
+	store.SetTracking(!g.noTrack)
 
 	if !dbfileExists {
-		cmdInit(db)
+		cmdInit(dbfile)
+	} else if store.Migrated() > 0 && opts.Verbose {
+		version, err := store.SchemaVersion(ctx)
+		check(err)
+		log.Printf("database upgraded to schema version %d\n", version)
+	}
+
+	if !store.FullTextSearch() && opts.Verbose {
+		log.Println("sqlite was built without FTS5, matching words with REGEXP")
+	}
+
+	gcTempFiles(false)
+	if runsRetention(args, opts) {
+		purgeExpired(ctx, store, opts)
 	}
 
 	w := new(tabwriter.Writer)
@@ -98,14 +166,14 @@ func main() {
 	// 	if dbfileExists {
 	// 		log.Fatal("database already exists, command ignored.")
 	// 	}
-	// 	cmdInit(db)
+	// 	cmdInit(ctx, store)
 	case args["mount"].(bool):
-		cmdMount(db, opts)
+		cmdMount(ctx, store, opts)
 	case args["new"].(bool):
-		cmdNew(db, opts)
+		cmdNew(ctx, store, opts)
 	case args["addfile"].(bool):
 		if len(args["<file>"].([]string)) > 0 {
-			cmdAddFiles(db, args["<file>"].([]string))
+			cmdAddFiles(ctx, store, args["<file>"].([]string))
 		} else {
 			reader := bufio.NewReader(os.Stdin)
 			for {
@@ -114,32 +182,71 @@ func main() {
 					break
 				}
 				sline := string(line)
-				cmdAddFiles(db, []string{sline})
+				cmdAddFiles(ctx, store, []string{sline})
 			}
 		}
 	case args["ls"].(bool) || args["grep"].(bool):
-		cmdLs(db, w, opts)
+		cmdLs(ctx, store, w, opts)
 	case args["cat"].(bool):
-		cmdCat(db, opts)
+		cmdCat(ctx, store, opts)
 	case args["show"].(bool):
-		cmdShow(db, opts)
+		cmdShow(ctx, store, opts)
 	case args["rm"].(bool) || args["remove"].(bool):
-		cmdRm(db, opts)
+		cmdRm(ctx, store, opts)
 	case args["unrm"].(bool) || args["unremove"].(bool) || args["recover"].(bool):
-		cmdUnrm(db, opts)
+		cmdUnrm(ctx, store, opts)
+	case args["mv"].(bool) || args["move"].(bool):
+		cmdMv(ctx, store, opts)
 	case args["edit"].(bool):
-		cmdEdit(db, opts)
+		cmdEdit(ctx, store, opts)
 	case args["mark"].(bool):
-		cmdMark(db, opts)
+		cmdMark(ctx, store, opts)
 	case args["unmark"].(bool):
-		cmdUnmark(db, opts)
+		cmdUnmark(ctx, store, opts)
 	case args["alias"].(bool):
-		cmdAlias(db, opts)
+		cmdAlias(ctx, store, opts)
 	case args["unalias"].(bool):
-		cmdUnalias(db, opts)
+		cmdUnalias(ctx, store, opts)
+	case args["tag"].(bool):
+		cmdTag(ctx, store, opts)
+	case args["untag"].(bool):
+		cmdUntag(ctx, store, opts)
+	case args["tags"].(bool):
+		cmdTags(ctx, store, w)
+	case args["backlinks"].(bool):
+		cmdBacklinks(ctx, store, w, opts)
+	case args["export"].(bool):
+		cmdExport(ctx, store, opts)
+	case args["import"].(bool):
+		cmdImport(ctx, store, w, opts)
+	case args["log"].(bool):
+		cmdLog(ctx, store, w, opts)
+	case args["diff"].(bool):
+		cmdDiff(ctx, store, opts)
+	case args["revert"].(bool):
+		cmdRevert(ctx, store, opts)
+	case args["gc-tmp"].(bool):
+		cmdGcTmp(opts)
+	case args["encrypt"].(bool):
+		cmdEncrypt(ctx, store, opts)
+	case args["serve"].(bool):
+		cmdServe(store, opts)
+	case args["browse"].(bool):
+		cmdBrowse(ctx, store, opts)
+	case args["getfile"].(bool):
+		cmdGetFile(ctx, store, opts)
+	case args["restore"].(bool):
+		opts.ToOriginal = true
+		cmdGetFile(ctx, store, opts)
+	case args["trash"].(bool):
+		cmdTrash(ctx, store, w)
+	case args["purge"].(bool):
+		cmdPurge(ctx, store, opts)
+	case args["notebooks"].(bool):
+		cmdNotebooks(ctx, store, w, dbfile)
 	case args["addattr"].(bool):
 		id, _ := strconv.Atoi(args["<id>"].(string))
-		cmdAddAttr(db, id, args["<filters>"].([]string))
+		cmdAddAttr(ctx, store, id, args["<filters>"].([]string))
 	default:
 		log.Println("Never reached")
 	}
@@ -147,6 +254,87 @@ func main() {
 	//w.Flush()
 }
 
+// globals are the options given before the command, they are not parsed
+// by docopt so that they are accepted with every command.
+type globals struct {
+	db       string
+	notebook string
+	noTrack  bool
+}
+
+// globalOptions removes the options given before the command from argv and
+// returns them.
+func globalOptions(argv []string) (rest []string, g globals) {
+	for len(argv) > 0 {
+		var value *string
+		switch {
+		case argv[0] == "--db":
+			value = &g.db
+		case argv[0] == "-n" || argv[0] == "--notebook":
+			value = &g.notebook
+		case argv[0] == "--no-track":
+			g.noTrack = true
+		case strings.HasPrefix(argv[0], "--db="):
+			g.db = strings.TrimPrefix(argv[0], "--db=")
+		case strings.HasPrefix(argv[0], "--notebook="):
+			g.notebook = strings.TrimPrefix(argv[0], "--notebook=")
+		default:
+			return argv, g
+		}
+
+		if value != nil {
+			if len(argv) < 2 {
+				log.Fatalf("%s requires a value", argv[0])
+			}
+			*value = argv[1]
+			argv = argv[1:]
+		}
+		argv = argv[1:]
+	}
+	return argv, g
+}
+
+// grepOptions makes -i ignore case in grep, as it does in grep(1), it lists
+// IDs in every other command. docopt gives a short option one meaning, so
+// -i is rewritten to -I before parsing, grep lists IDs with --list-ids.
+func grepOptions(argv []string) []string {
+	if len(argv) == 0 || argv[0] != "grep" {
+		return argv
+	}
+
+	rest := make([]string, len(argv))
+	copy(rest, argv)
+	for i := 1; i < len(rest); i++ {
+		arg := rest[i]
+		switch {
+		case arg == "--":
+			return rest
+		case arg == "--offset" || arg == "--limit" || arg == "--after" || arg == "--sort" ||
+			arg == "--since" || arg == "--until" || arg == "--created" || arg == "--updated":
+			// the value may start with a dash
+			i++
+		case len(arg) > 1 && arg[0] == '-' && arg[1] != '-':
+			flags := []byte(arg)
+			skip := false
+			for j := 1; j < len(flags); j++ {
+				if strings.IndexByte("oLA", flags[j]) >= 0 {
+					// the rest of arg, or the next argument, is the value
+					skip = j == len(flags)-1
+					break
+				}
+				if flags[j] == 'i' {
+					flags[j] = 'I'
+				}
+			}
+			rest[i] = string(flags)
+			if skip {
+				i++
+			}
+		}
+	}
+	return rest
+}
+
 func randSeq(n int) string {
 	b := make([]rune, n)
 	for i := range b {
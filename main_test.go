@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGrepOptions(t *testing.T) {
+	tests := []struct {
+		argv, want string
+	}{
+		{"grep -i todo", "grep -I todo"},
+		{"grep -win todo", "grep -wIn todo"},
+		{"grep --list-ids todo", "grep --list-ids todo"},
+		{"grep -L10 -i x", "grep -L10 -I x"},
+		{"grep -Li -i x", "grep -Li -I x"},
+		{"grep -o -i x", "grep -o -i x"},
+		{"grep --sort -i -i x", "grep --sort -i -I x"},
+		{"grep -- -i", "grep -- -i"},
+		{"ls -i todo", "ls -i todo"},
+	}
+	for _, test := range tests {
+		if got := strings.Join(grepOptions(strings.Fields(test.argv)), " "); got != test.want {
+			t.Errorf("grepOptions(%s) = %s, want %s", test.argv, got, test.want)
+		}
+	}
+}
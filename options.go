@@ -1,14 +1,18 @@
 package main
 
 import (
+	"log"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"time"
+
+	"github.com/siadat/eton/eton"
 )
 
 const (
 	novalue         = "nil"
-	datelayout      = "06/01/02 03:04pm"
 	ellipsis        = "…"
 	maxShownMatches = -1
 )
@@ -20,9 +24,10 @@ type options struct {
 	Aliases         []string
 	Limit           int
 	Offset          int
+	Paged           bool
 	RootID          int64
-	Indent          int
 	Filters         []string
+	Tags            []string
 	FromStdin       bool
 	Recursive       bool
 	IncludeRemoved  bool
@@ -30,11 +35,37 @@ type options struct {
 	Verbose         bool
 	ListFilepaths   bool
 	ListIDs         bool
+	Regexp          bool
+	WordRegexp      bool
+	IgnoreCase      bool
+	Count           bool
+	LineNumbers     bool
+	Since           time.Time
+	Until           time.Time
+	CreatedSince    time.Time
+	CreatedUntil    time.Time
+	OlderThan       time.Time
+	Sort            string
+	JSON            bool
+	JSONLines       bool
 	MountPoint      string
+	Dir             string
+	Format          string
+	DryRun          bool
+	Dest            string
+	ToOriginal      bool
+	Force           bool
+	Encrypt         bool
+	KeyFile         string
+	Listen          string
+	Token           string
 	Note            string
+	Parent          string
 	AfterLinesCount int
 	Alias1          string
 	Alias2          string
+	Rev1            int
+	Rev2            int
 }
 
 func optionsFromArgs(args map[string]interface{}) (opts options) {
@@ -42,7 +73,6 @@ func optionsFromArgs(args map[string]interface{}) (opts options) {
 	var err error
 
 	opts.RootID = -1
-	opts.Indent = 0
 	opts.ListFilepaths = args["--list-files"].(bool)
 	opts.ListIDs = args["--list-ids"].(bool)
 
@@ -56,11 +86,15 @@ func optionsFromArgs(args map[string]interface{}) (opts options) {
 	opts.AfterLinesCount, err = strconv.Atoi(args["--after"].(string))
 	check(err)
 
-	if args["--all"].(bool) || args["--limit"].(string) == "all" {
-		opts.Limit = -1
-	} else {
-		opts.Limit, err = strconv.Atoi(args["--limit"].(string))
-		check(err)
+	limit := cfg.get("limit")
+	if args["--limit"] != nil {
+		limit = args["--limit"].(string)
+	}
+	if args["--all"].(bool) {
+		limit = "all"
+	}
+	if opts.Limit, err = parseLimit(limit); err != nil {
+		log.Fatal(err)
 	}
 
 	if args["<id1>"] != nil {
@@ -78,6 +112,51 @@ func optionsFromArgs(args map[string]interface{}) (opts options) {
 		opts.MountPoint = filepath.Join(homeDir(), "eton-default-mount-point")
 	}
 
+	if args["<dir>"] != nil {
+		opts.Dir = args["<dir>"].(string)
+	}
+
+	if args["--json"] != nil {
+		opts.JSON = args["--json"].(bool)
+		opts.JSONLines = args["--jsonl"].(bool)
+	}
+
+	if args["--dry-run"] != nil {
+		opts.DryRun = args["--dry-run"].(bool)
+	}
+
+	if args["<dest>"] != nil {
+		opts.Dest = args["<dest>"].(string)
+	}
+
+	if args["--to-original"] != nil {
+		opts.ToOriginal = args["--to-original"].(bool)
+	}
+
+	if args["--force"] != nil {
+		opts.Force = args["--force"].(bool)
+	}
+
+	if args["--encrypt"] != nil {
+		opts.Encrypt = args["--encrypt"].(bool)
+	}
+
+	if args["--key-file"] != nil {
+		opts.KeyFile = args["--key-file"].(string)
+	}
+
+	if args["--listen"] != nil {
+		opts.Listen = args["--listen"].(string)
+	}
+
+	if args["--token"] != nil {
+		opts.Token = args["--token"].(string)
+	}
+
+	if args["--format"] != nil {
+		opts.Format = args["--format"].(string)
+	}
+
 	if args["<id2>"] != nil {
 		intID, err := strconv.Atoi(args["<id2>"].(string))
 		if err == nil {
@@ -105,19 +184,156 @@ func optionsFromArgs(args map[string]interface{}) (opts options) {
 		}
 	}
 
+	if args["<rev1>"] != nil {
+		opts.Rev1, err = strconv.Atoi(args["<rev1>"].(string))
+		check(err)
+	}
+
+	if args["<rev>"] != nil {
+		opts.Rev1, err = strconv.Atoi(args["<rev>"].(string))
+		check(err)
+	}
+
+	if args["<rev2>"] != nil {
+		opts.Rev2, err = strconv.Atoi(args["<rev2>"].(string))
+		check(err)
+	}
+
 	if args["<alias>"] != nil {
 		opts.Alias = args["<alias>"].(string)
 	}
 
+	if args["<tags>"] != nil {
+		opts.Tags = args["<tags>"].([]string)
+	}
+
 	opts.Filters = args["<filters>"].([]string)
+
+	if args["--since"] != nil {
+		opts.Since, _ = parseTimeOption("--since", args["--since"].(string))
+	}
+	if args["--until"] != nil {
+		_, opts.Until = parseTimeOption("--until", args["--until"].(string))
+	}
+	// --created and --updated take the values of created: and updated:
+	// filters, but are not part of the query, which grep -E replaces
+	if args["--created"] != nil {
+		opts.CreatedSince, opts.CreatedUntil = parseTimeBounds("--created", args["--created"].(string))
+	}
+	if args["--updated"] != nil {
+		since, until := parseTimeBounds("--updated", args["--updated"].(string))
+		opts.Since, opts.Until = intersectTime(opts.Since, opts.Until, since, until)
+	}
+	if args["--older-than"] != nil {
+		opts.OlderThan, _ = parseTimeOption("--older-than", args["--older-than"].(string))
+	}
+	if args["--sort"] != nil {
+		opts.Sort = args["--sort"].(string)
+	}
 	opts.FromStdin = args["-"].(bool)
-	opts.Recursive = false // args["--recursive"].(bool)
+	if args["--recursive"] != nil {
+		opts.Recursive = args["--recursive"].(bool)
+	}
+
+	if args["--parent"] != nil {
+		opts.Parent = args["--parent"].(string)
+	}
 	opts.IncludeRemoved = args["--removed"].(bool)
 	opts.ShortMode = args["--short"].(bool)
 	opts.Verbose = args["--verbose"].(bool)
+
+	if args["grep"].(bool) {
+		opts.Regexp = args["--regexp"].(bool)
+		opts.WordRegexp = args["--word-regexp"].(bool)
+		opts.Count = args["--count"].(bool)
+		opts.LineNumbers = args["--line-number"].(bool)
+		opts.IgnoreCase = args["--ignore-case"].(bool)
+	}
 	return opts
 }
 
+// parseTimeOption parses the date or age of a time filter, see
+// eton.ParseTimeRange.
+func parseTimeOption(name, value string) (from, to time.Time) {
+	from, to, err := eton.ParseTimeRange(value, time.Now())
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+	return from, to
+}
+
+// parseTimeBounds parses the value of --created or --updated, see
+// eton.ParseTimeBounds.
+func parseTimeBounds(name, value string) (since, until time.Time) {
+	since, until, err := eton.ParseTimeBounds(value, time.Now())
+	if err != nil {
+		log.Fatalf("%s: invalid date %q, expected e.g. 2026-01-31, '>2026-01-31' or an age such as '<3d' or '>2w'", name, value)
+	}
+	return since, until
+}
+
+// intersectTime returns the intersection of [since, until) and
+// [since2, until2), zero bounds are open.
+func intersectTime(since, until, since2, until2 time.Time) (time.Time, time.Time) {
+	if since2.After(since) {
+		since = since2
+	}
+	if !until2.IsZero() && (until.IsZero() || until2.Before(until)) {
+		until = until2
+	}
+	return since, until
+}
+
+// regexpMode reports whether grep filters are matched as regular
+// expressions rather than parsed as a query.
+func (opts options) regexpMode() bool {
+	return opts.Regexp || opts.WordRegexp
+}
+
+// grepPatterns returns the filters as regular expressions, with the
+// -w and -i flags applied.
+func (opts options) grepPatterns() []string {
+	patterns := make([]string, len(opts.Filters))
+	for i, filter := range opts.Filters {
+		if !opts.Regexp {
+			filter = regexp.QuoteMeta(filter)
+		}
+		if opts.WordRegexp {
+			filter = `\b(?:` + filter + `)\b`
+		}
+		if opts.IgnoreCase {
+			filter = "(?i)" + filter
+		}
+		patterns[i] = filter
+	}
+	return patterns
+}
+
+// listOptions returns the options of an "ls" for the store.
+func (opts options) listOptions() eton.ListOptions {
+	listOpts := eton.ListOptions{
+		Filters:    opts.Filters,
+		Limit:      opts.Limit,
+		Offset:     opts.Offset,
+		Paged:      opts.Paged,
+		RootID:     opts.RootID,
+		Recursive:  opts.Recursive,
+		Removed:    opts.IncludeRemoved,
+		MarkedOnly: opts.ShortMode,
+		Since:      opts.Since,
+		Until:      opts.Until,
+
+		CreatedSince: opts.CreatedSince,
+		CreatedUntil: opts.CreatedUntil,
+		Sort:         opts.Sort,
+	}
+	if opts.regexpMode() {
+		listOpts.Filters = nil
+		listOpts.Patterns = opts.grepPatterns()
+	}
+	return listOpts
+}
+
 func (opts options) getIDsArrayOfInterface() []interface{} {
 	var interfaceIds = make([]interface{}, len(opts.IDs), len(opts.IDs))
 	for i, id := range opts.IDs {
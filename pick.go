@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/andrew-d/go-termutil"
+	"github.com/siadat/eton/eton"
+)
+
+// resolveAmbiguity lets the user pick one of the candidates if err is an
+// *eton.AmbiguousError and STDIN is a terminal. Otherwise, scripts get the
+// candidates and exit status 1.
+func resolveAmbiguity(ctx context.Context, store eton.Store, attr eton.Attr, err error) (eton.Attr, error) {
+	var ambiguous *eton.AmbiguousError
+	if !errors.As(err, &ambiguous) {
+		return attr, err
+	}
+
+	if !termutil.Isatty(os.Stdin.Fd()) {
+		exitAmbiguous(ambiguous)
+	}
+	return store.Get(ctx, pickCandidate(ambiguous).ID.Int64)
+}
+
+// findAttributeByAliasStrict is findAttributeByAlias for the commands that
+// must not guess: the alias must match exactly, or be the only good fuzzy
+// match. Frecency does not decide and the user is not asked.
+func findAttributeByAliasStrict(ctx context.Context, store eton.Store, alias string) attrStruct {
+	attr, err := store.FindByAlias(ctx, alias, true)
+	if errors.Is(err, eton.ErrNotFound) {
+		var matches []eton.AliasMatch
+		matches, err = store.MatchAlias(ctx, alias)
+		check(err)
+		if attr, err = eton.PickMatch(alias, matches, true); err == nil {
+			attr, err = store.Get(ctx, attr.ID.Int64)
+		}
+	}
+
+	var ambiguous *eton.AmbiguousError
+	if errors.As(err, &ambiguous) {
+		exitAmbiguous(ambiguous)
+	}
+	return attrFromStore(attr, err)
+}
+
+// exitAmbiguous lists the candidates of an ambiguous alias and exits.
+func exitAmbiguous(ambiguous *eton.AmbiguousError) {
+	fmt.Fprintf(os.Stderr, "%q is ambiguous, it matches:\n", ambiguous.Alias)
+	printCandidates(os.Stderr, ambiguous.Candidates, false)
+	os.Exit(1)
+}
+
+func printCandidates(f *os.File, candidates []eton.AliasMatch, numbered bool) {
+	w := tabwriter.NewWriter(f, 0, 0, 2, ' ', 0)
+	for i, candidate := range candidates {
+		attr := attrStruct{candidate.Attr}
+		if numbered {
+			fmt.Fprintf(w, "  %d)", i+1)
+		}
+		fmt.Fprintf(w, "  %s\t%s\n", attr.getIdentifier(), attr.title())
+	}
+	w.Flush()
+}
+
+// pickCandidate asks the user to pick one of the candidates of an ambiguous
+// alias. It uses /dev/tty, because STDOUT may be piped.
+func pickCandidate(ambiguous *eton.AmbiguousError) eton.AliasMatch {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		exitAmbiguous(ambiguous)
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "%q is ambiguous, it matches:\n", ambiguous.Alias)
+	printCandidates(tty, ambiguous.Candidates, true)
+
+	reader := bufio.NewReader(tty)
+	for {
+		fmt.Fprintf(tty, "pick 1-%d, or q to abort: ", len(ambiguous.Candidates))
+		line, err := reader.ReadString('\n')
+		answer := strings.TrimSpace(line)
+		if err != nil || answer == "q" || len(answer) == 0 {
+			log.Fatal("aborted")
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(ambiguous.Candidates) {
+			return ambiguous.Candidates[n-1]
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/siadat/eton/eton"
+)
+
+// matchOptions are how ls and grep print the lines of notes that match the
+// filters.
+type matchOptions struct {
+	pattern     *regexp.Regexp // nil to only print the titles
+	after       int            // lines printed after a match
+	lineNumbers bool
+}
+
+func (opts options) matchOptions() matchOptions {
+	return matchOptions{
+		pattern:     highlightPattern(opts),
+		after:       opts.AfterLinesCount,
+		lineNumbers: opts.LineNumbers,
+	}
+}
+
+// highlightPattern returns the regular expression matching any filter, nil
+// if there are no filters to highlight.
+func highlightPattern(opts options) *regexp.Regexp {
+	var patterns []string
+	if opts.regexpMode() {
+		patterns = opts.grepPatterns()
+	} else {
+		for _, term := range highlightTerms(opts.Filters) {
+			patterns = append(patterns, "(?i)"+regexp.QuoteMeta(term))
+		}
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	for i, pattern := range patterns {
+		patterns[i] = "(?:" + pattern + ")"
+	}
+	re, err := regexp.Compile(strings.Join(patterns, "|"))
+	if err != nil {
+		return nil
+	}
+	return re
+}
+
+// highlightTerms returns the words searched for by filters, without the
+// phrase and prefix syntax, the field terms and the negated words.
+func highlightTerms(filters []string) []string {
+	query, err := eton.ParseQuery(filters)
+	if err != nil {
+		return nil
+	}
+	return query.Highlights()
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/siadat/eton/eton"
+)
+
+// apiServer serves the store as a JSON REST API:
+//
+//   GET    /notes                  list, see listOptionsFromQuery
+//   POST   /notes                  create {"value_text": ..., "parent_id": ...}
+//   GET    /notes/<id>             get by ID or exact alias
+//   PUT    /notes/<id>             update {"value_text": ...}
+//   DELETE /notes/<id>             rm, ?recursive=1 removes the notes under it
+//   POST   /notes/<id>/unrm        unrm, ?recursive=1
+//   PUT    /notes/<id>/mark        mark
+//   DELETE /notes/<id>/mark        unmark
+//   PUT    /notes/<id>/alias       alias {"alias": ...}
+//   DELETE /notes/<id>/alias       unalias
+//
+// Notes are encoded like "eton ls --json". Responses with a single note carry
+// its ETag, PUT and DELETE requests are refused with 412 if their If-Match
+// header does not match the current ETag. PUT requests without If-Match are
+// refused with 428, so that a client cannot overwrite changes it has not
+// seen. Requests do not count as accesses to the notes.
+//
+// Every request needs the token, and POST and PUT requests the JSON content
+// type, which browsers cannot send cross-site without a preflight. The Host
+// header is checked against the listen address, against DNS rebinding.
+type apiServer struct {
+	store   eton.Store
+	token   string
+	host    string // host of the listen address, empty if unspecified
+	verbose bool
+
+	// mu makes the If-Match check and the write that follows it atomic
+	mu sync.Mutex
+}
+
+// apiError is the body of error responses.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// noteRequest is the body of POST /notes and PUT /notes/<id>.
+type noteRequest struct {
+	ValueText *string `json:"value_text"`
+	ParentID  *int64  `json:"parent_id"`
+}
+
+type aliasRequest struct {
+	Alias string `json:"alias"`
+}
+
+// maxRequestBody is the size limit of request bodies, in bytes
+const maxRequestBody = 16 << 20
+
+// serve runs the API on opts.Listen until the process is interrupted.
+func serve(store eton.Store, opts options) error {
+	if len(opts.Token) == 0 {
+		opts.Token = os.Getenv("ETON_TOKEN")
+	}
+	if len(opts.Token) == 0 {
+		token := make([]byte, 16)
+		if _, err := rand.Read(token); err != nil {
+			return err
+		}
+		opts.Token = hex.EncodeToString(token)
+		log.Printf("no token given, clients must send \"Authorization: Bearer %s\"", opts.Token)
+	}
+
+	host, _, err := net.SplitHostPort(opts.Listen)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = ""
+	}
+
+	server := &http.Server{
+		Addr:    opts.Listen,
+		Handler: newAPIServer(store, opts.Token, host, opts.Verbose),
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	if opts.Verbose {
+		log.Println("listening on", opts.Listen)
+	}
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// newAPIServer returns the handler of the API, it stops counting accesses
+// to the notes of store.
+func newAPIServer(store eton.Store, token, host string, verbose bool) *apiServer {
+	store.SetTracking(false)
+	return &apiServer{store: store, token: token, host: host, verbose: verbose}
+}
+
+// allowedHost reports whether the Host header of a request names the
+// server: its listen address, or localhost. Any host is allowed if the
+// server listens on every address.
+func (s *apiServer) allowedHost(r *http.Request) bool {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	return len(s.host) == 0 || strings.EqualFold(host, s.host) ||
+		strings.EqualFold(host, "localhost") || host == "127.0.0.1" || host == "::1"
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.verbose {
+		log.Println(r.Method, r.URL)
+	}
+
+	if !s.allowedHost(r) {
+		writeAPIError(w, http.StatusMisdirectedRequest, fmt.Errorf("unknown host %q", r.Host))
+		return
+	}
+
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="eton"`)
+		writeAPIError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+		return
+	}
+
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			writeAPIError(w, http.StatusUnsupportedMediaType, errors.New("Content-Type must be application/json"))
+			return
+		}
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	if parts[0] != "notes" || len(parts) > 3 {
+		writeAPIError(w, http.StatusNotFound, errors.New("no such endpoint"))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.list(w, r)
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		s.create(w, r)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		s.get(w, r, parts[1])
+	case len(parts) == 2 && r.Method == http.MethodPut:
+		s.update(w, r, parts[1])
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		s.rm(w, r, parts[1])
+	case len(parts) == 3 && parts[2] == "unrm" && r.Method == http.MethodPost:
+		s.unrm(w, r, parts[1])
+	case len(parts) == 3 && parts[2] == "mark" && (r.Method == http.MethodPut || r.Method == http.MethodDelete):
+		s.mark(w, r, parts[1])
+	case len(parts) == 3 && parts[2] == "alias" && (r.Method == http.MethodPut || r.Method == http.MethodDelete):
+		s.alias(w, r, parts[1])
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed on /%s", r.Method, path))
+	}
+}
+
+// authorized checks the "Authorization: Bearer <token>" header.
+func (s *apiServer) authorized(r *http.Request) bool {
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) == 1
+}
+
+func (s *apiServer) list(w http.ResponseWriter, r *http.Request) {
+	listOpts, err := listOptionsFromQuery(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	attrs, err := s.store.List(r.Context(), listOpts)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, attrsFromStore(attrs))
+}
+
+// listOptionsFromQuery reads the options of "eton ls" from the query string:
+// filter (repeated), pattern (repeated, like grep -E), limit (a number or
+// "all"), offset, sort, since, until, created, updated, recursive, removed
+// and marked.
+func listOptionsFromQuery(r *http.Request) (listOpts eton.ListOptions, err error) {
+	query := r.URL.Query()
+
+	listOpts.Filters = query["filter"]
+	listOpts.RootID = -1
+
+	for _, pattern := range query["pattern"] {
+		if _, err = regexp.Compile(pattern); err != nil {
+			return listOpts, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	listOpts.Patterns = query["pattern"]
+
+	limit := query.Get("limit")
+	if len(limit) == 0 {
+		limit = cfg.get("limit")
+	}
+	if listOpts.Limit, err = parseLimit(limit); err != nil {
+		return listOpts, err
+	}
+
+	if offset := query.Get("offset"); len(offset) > 0 {
+		if listOpts.Offset, err = strconv.Atoi(offset); err != nil {
+			return listOpts, fmt.Errorf("invalid offset %q", offset)
+		}
+	}
+
+	if listOpts.Sort = query.Get("sort"); len(listOpts.Sort) > 0 && !validSort(listOpts.Sort) {
+		return listOpts, fmt.Errorf("invalid sort %q, expected one of %s", listOpts.Sort, strings.Join(eton.SortOrders(), ", "))
+	}
+
+	now := time.Now()
+	if since := query.Get("since"); len(since) > 0 {
+		if listOpts.Since, _, err = eton.ParseTimeRange(since, now); err != nil {
+			return listOpts, fmt.Errorf("since: %v", err)
+		}
+	}
+	if until := query.Get("until"); len(until) > 0 {
+		if _, listOpts.Until, err = eton.ParseTimeRange(until, now); err != nil {
+			return listOpts, fmt.Errorf("until: %v", err)
+		}
+	}
+	if created := query.Get("created"); len(created) > 0 {
+		if listOpts.CreatedSince, listOpts.CreatedUntil, err = eton.ParseTimeBounds(created, now); err != nil {
+			return listOpts, fmt.Errorf("created: %v", err)
+		}
+	}
+	if updated := query.Get("updated"); len(updated) > 0 {
+		since, until, err := eton.ParseTimeBounds(updated, now)
+		if err != nil {
+			return listOpts, fmt.Errorf("updated: %v", err)
+		}
+		listOpts.Since, listOpts.Until = intersectTime(listOpts.Since, listOpts.Until, since, until)
+	}
+
+	listOpts.Recursive = queryBool(r, "recursive")
+	listOpts.Removed = queryBool(r, "removed")
+	listOpts.MarkedOnly = queryBool(r, "marked")
+	return listOpts, nil
+}
+
+func validSort(order string) bool {
+	for _, name := range eton.SortOrders() {
+		if name == order {
+			return true
+		}
+	}
+	return false
+}
+
+func queryBool(r *http.Request, key string) bool {
+	value := r.URL.Query().Get(key)
+	return value == "1" || value == "true"
+}
+
+func (s *apiServer) create(w http.ResponseWriter, r *http.Request) {
+	var req noteRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if req.ValueText == nil {
+		writeAPIError(w, http.StatusBadRequest, errors.New("value_text is required"))
+		return
+	}
+
+	var parentID int64 = -1
+	if req.ParentID != nil {
+		if _, err := s.store.Get(r.Context(), *req.ParentID); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		parentID = *req.ParentID
+	}
+
+	id, err := s.store.CreateNote(r.Context(), *req.ValueText, parentID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	attr, err := s.store.Get(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/notes/%d", id))
+	writeAttr(w, http.StatusCreated, attr)
+}
+
+func (s *apiServer) get(w http.ResponseWriter, r *http.Request, identifier string) {
+	attr, err := s.find(r.Context(), identifier)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if r.Header.Get("If-None-Match") == etag(attr) {
+		w.Header().Set("ETag", etag(attr))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeAttr(w, http.StatusOK, attr)
+}
+
+func (s *apiServer) update(w http.ResponseWriter, r *http.Request, identifier string) {
+	attr, ok := s.findForWrite(w, r, identifier)
+	if !ok {
+		return
+	}
+
+	var req noteRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if req.ValueText == nil {
+		writeAPIError(w, http.StatusBadRequest, errors.New("value_text is required"))
+		return
+	}
+
+	if *req.ValueText != attr.ValueText.String {
+		if _, err := s.store.UpdateIfVersion(r.Context(), attr.ID.Int64, *req.ValueText, attr.Version); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+	s.writeCurrent(w, r, attr.ID.Int64)
+}
+
+func (s *apiServer) rm(w http.ResponseWriter, r *http.Request, identifier string) {
+	attr, ok := s.findForWrite(w, r, identifier)
+	if !ok {
+		return
+	}
+
+	if _, err := s.store.Remove(r.Context(), attr.ID.Int64, queryBool(r, "recursive")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *apiServer) unrm(w http.ResponseWriter, r *http.Request, identifier string) {
+	// removed notes are only found by their ID or exact alias
+	id, err := strconv.ParseInt(identifier, 10, 64)
+	if err != nil {
+		attr, err := s.store.FindByAlias(r.Context(), identifier, true)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		id = attr.ID.Int64
+	}
+
+	if _, err := s.store.Unremove(r.Context(), id, queryBool(r, "recursive")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.writeCurrent(w, r, id)
+}
+
+func (s *apiServer) mark(w http.ResponseWriter, r *http.Request, identifier string) {
+	attr, ok := s.findForWrite(w, r, identifier)
+	if !ok {
+		return
+	}
+
+	mark := 1
+	if r.Method == http.MethodDelete {
+		mark = 0
+	}
+	if _, err := s.store.SetMark(r.Context(), attr.ID.Int64, mark); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.writeCurrent(w, r, attr.ID.Int64)
+}
+
+func (s *apiServer) alias(w http.ResponseWriter, r *http.Request, identifier string) {
+	attr, ok := s.findForWrite(w, r, identifier)
+	if !ok {
+		return
+	}
+
+	var req aliasRequest
+	if r.Method == http.MethodPut {
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+		if len(req.Alias) == 0 {
+			writeAPIError(w, http.StatusBadRequest, errors.New("alias is required, use DELETE to unalias"))
+			return
+		}
+	}
+
+	if _, err := s.store.SetAlias(r.Context(), attr.ID.Int64, req.Alias); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.writeCurrent(w, r, attr.ID.Int64)
+}
+
+// find returns the note with the given ID or alias. Unlike the CLI, aliases
+// are matched exactly: a client must not act on a guess.
+func (s *apiServer) find(ctx context.Context, identifier string) (eton.Attr, error) {
+	if id, err := strconv.ParseInt(identifier, 10, 64); err == nil {
+		return s.store.Get(ctx, id)
+	}
+	attr, err := s.store.FindByAlias(ctx, identifier, true)
+	if err == nil && attr.DeletedAt.Valid {
+		// only unrm finds removed notes
+		return eton.Attr{}, fmt.Errorf("%w: %s is removed", eton.ErrNotFound, identifier)
+	}
+	return attr, err
+}
+
+// findForWrite returns the note modified by a request, after checking its
+// If-Match header, which PUT requests require.
+func (s *apiServer) findForWrite(w http.ResponseWriter, r *http.Request, identifier string) (eton.Attr, bool) {
+	attr, err := s.find(r.Context(), identifier)
+	if err != nil {
+		writeStoreError(w, err)
+		return attr, false
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if len(ifMatch) == 0 && r.Method == http.MethodPut {
+		writeAPIError(w, http.StatusPreconditionRequired, errors.New("If-Match is required, send the ETag of the note"))
+		return attr, false
+	}
+	if len(ifMatch) > 0 && !etagMatches(ifMatch, etag(attr)) {
+		w.Header().Set("ETag", etag(attr))
+		writeAPIError(w, http.StatusPreconditionFailed, errors.New("note was modified, fetch it again"))
+		return attr, false
+	}
+	return attr, true
+}
+
+// writeCurrent responds with the note as it is after a write.
+func (s *apiServer) writeCurrent(w http.ResponseWriter, r *http.Request, id int64) {
+	attr, err := s.store.Get(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeAttr(w, http.StatusOK, attr)
+}
+
+// etag identifies a version of a note. It is derived from the version of
+// its content, and a hash of the other fields the API can modify.
+func etag(attr eton.Attr) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s\x00%d\x00%v", attr.Alias.String, attr.Mark.Int64, attr.DeletedAt.Valid)
+	return fmt.Sprintf(`"%d-%d-%08x"`, attr.ID.Int64, attr.Version, h.Sum32())
+}
+
+// etagMatches reports whether an If-Match header matches current.
+func etagMatches(ifMatch, current string) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeRequest reads the JSON body of a request into v, at most
+// maxRequestBody bytes. It responds with 400 and returns false on errors.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func writeAttr(w http.ResponseWriter, status int, attr eton.Attr) {
+	w.Header().Set("ETag", etag(attr))
+	writeJSON(w, status, attr)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		log.Println("error:", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
+
+// writeStoreError responds with the HTTP status of an error returned by the
+// store.
+func writeStoreError(w http.ResponseWriter, err error) {
+	var queryError *eton.QueryError
+	switch {
+	case errors.Is(err, eton.ErrNotFound):
+		writeAPIError(w, http.StatusNotFound, err)
+	case errors.Is(err, eton.ErrAliasTaken), errors.Is(err, eton.ErrHasChildren), errors.Is(err, eton.ErrEncrypted), errors.Is(err, eton.ErrAmbiguous):
+		writeAPIError(w, http.StatusConflict, err)
+	case errors.Is(err, eton.ErrConflict):
+		writeAPIError(w, http.StatusPreconditionFailed, err)
+	case errors.Is(err, eton.ErrInvalidAlias), errors.Is(err, eton.ErrCycle), errors.As(err, &queryError):
+		writeAPIError(w, http.StatusBadRequest, err)
+	default:
+		log.Println("error:", err)
+		writeAPIError(w, http.StatusInternalServerError, errors.New("internal error"))
+	}
+}
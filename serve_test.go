@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/siadat/eton/eton"
+)
+
+func TestServe(t *testing.T) {
+	ctx, store := openTestStore(t)
+	id := createNote(t, ctx, store, "docker run", "docker-notes")
+	createNote(t, ctx, store, "k8s apply", "")
+	server := newAPIServer(store, "secret", "", false)
+
+	do := func(method, target, ifMatch, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer secret")
+		if len(body) > 0 {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		if len(ifMatch) > 0 {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		method, target string
+		status         int
+	}{
+		{"GET", "/notes/docker-notes", http.StatusOK},
+		{"GET", "/notes/docker", http.StatusNotFound},
+		{"PUT", "/notes/docker-notes", http.StatusPreconditionRequired},
+		{"GET", "/notes?sort=size", http.StatusBadRequest},
+		{"GET", "/notes?since=yesterday", http.StatusBadRequest},
+		{"GET", "/notes?pattern=(", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if w := do(test.method, test.target, "", `{"value_text": "x"}`); w.Code != test.status {
+			t.Errorf("%s %s = %d, want %d: %s", test.method, test.target, w.Code, test.status, w.Body)
+		}
+	}
+
+	w := do("GET", "/notes?pattern=doc.er&sort=created&since=1d&created=<1d&updated=<1d", "", "")
+	var listed []struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil || len(listed) != 1 || listed[0].ID != id {
+		t.Errorf("GET /notes with a pattern = %s, want note %d", w.Body, id)
+	}
+
+	current := do("GET", "/notes/docker-notes", "", "").Header().Get("ETag")
+	if w := do("PUT", "/notes/docker-notes", `"stale"`, `{"value_text": "x"}`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with a stale ETag = %d, want 412", w.Code)
+	}
+	if w := do("PUT", "/notes/docker-notes", current, `{"value_text": "docker ps"}`); w.Code != http.StatusOK {
+		t.Errorf("PUT with the ETag = %d, want 200: %s", w.Code, w.Body)
+	}
+
+	attrs, err := store.List(ctx, eton.ListOptions{Filters: []string{fmt.Sprintf("id:%d", id)}, Limit: -1, RootID: -1})
+	if err != nil || len(attrs) != 1 {
+		t.Fatalf("List(id:%d) = %v, %v", id, attrs, err)
+	}
+	if attrs[0].Frequency.Int64 != 0 || attrs[0].AccessedAt.Valid {
+		t.Errorf("requests counted %d accesses, want none", attrs[0].Frequency.Int64)
+	}
+}
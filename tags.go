@@ -0,0 +1,10 @@
+package main
+
+import "strings"
+
+func (attr attrStruct) prettyTags() string {
+	if len(attr.Tags) == 0 {
+		return ""
+	}
+	return " " + color("#"+strings.Join(attr.Tags, " #"), themeColor("tag"))
+}
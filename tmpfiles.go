@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Temporary files are created in a private runtime directory, see
+// runtimeDir. Files opened in the editor are removed when it exits, files
+// listed by "ls -l" are kept for xargs and friends until they expire or
+// "eton gc-tmp" is run.
+const (
+	editFilePrefix = "edit-"
+	listFilePrefix = "ls-"
+
+	listFileTTL = time.Hour
+	editFileTTL = 24 * time.Hour
+
+	// legacyTempFilePattern matches the world-readable files left in /tmp by
+	// previous versions
+	legacyTempFilePattern = "/tmp/eton-edit*"
+)
+
+// tempFiles are the files to remove if eton is terminated
+var tempFiles = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// runtimeDirPath returns $XDG_RUNTIME_DIR/eton, or /tmp/eton-<uid> if
+// XDG_RUNTIME_DIR is not set. /tmp is used rather than os.TempDir() because
+// fsnotify cannot watch files in the latter on macOS.
+func runtimeDirPath() string {
+	if base := os.Getenv("XDG_RUNTIME_DIR"); len(base) > 0 {
+		return filepath.Join(base, "eton")
+	}
+	return filepath.Join("/tmp", fmt.Sprintf("eton-%d", os.Getuid()))
+}
+
+// runtimeDir returns the directory of temporary files, creating it with
+// mode 0700 if needed. It refuses to use a directory that another user
+// could read.
+func runtimeDir() string {
+	dir := runtimeDirPath()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Fatal(err)
+	}
+
+	info, err := os.Lstat(dir)
+	check(err)
+	if !info.IsDir() || !isOwnedByCurrentUser(info) {
+		log.Fatalf("%s is not a directory owned by you, remove it and try again", dir)
+	}
+	if info.Mode().Perm() != 0700 {
+		check(os.Chmod(dir, 0700))
+	}
+	return dir
+}
+
+// writeTempFile returns the path of a new file readable only by the current
+// user, holding content.
+func writeTempFile(prefix, content string) string {
+	f, err := ioutil.TempFile(runtimeDir(), prefix)
+	check(err)
+	defer f.Close()
+
+	_, err = f.WriteString(content)
+	check(err)
+	return f.Name()
+}
+
+// trackTempFile removes path if eton is terminated before removeTempFile is
+// called.
+func trackTempFile(path string) {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	tempFiles.paths[path] = true
+}
+
+func removeTempFile(path string) {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	os.Remove(path)
+	delete(tempFiles.paths, path)
+}
+
+func removeTempFiles() {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	for path := range tempFiles.paths {
+		os.Remove(path)
+		delete(tempFiles.paths, path)
+	}
+}
+
+// cleanupOnSignal removes the tracked temporary files and exits when eton
+// is terminated, until the returned function is called. CTRL-c is ignored,
+// it is meant for the editor.
+func cleanupOnSignal() (stop func()) {
+	sig := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+
+	go func() {
+		for {
+			select {
+			case s := <-sig:
+				if s == os.Interrupt {
+					continue
+				}
+				removeTempFiles()
+				os.Exit(1)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sig)
+		close(done)
+	}
+}
+
+// gcTempFiles removes the expired temporary files. With all, it removes
+// every file listed by "ls -l", and the files left in /tmp by previous
+// versions.
+func gcTempFiles(all bool) (removed int) {
+	dir := runtimeDirPath()
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("error:", err)
+	}
+
+	for _, entry := range entries {
+		age := time.Since(entry.ModTime())
+		expired := strings.HasPrefix(entry.Name(), listFilePrefix) && (all || age > listFileTTL) ||
+			strings.HasPrefix(entry.Name(), editFilePrefix) && age > editFileTTL
+		if expired && os.Remove(filepath.Join(dir, entry.Name())) == nil {
+			removed++
+		}
+	}
+
+	if all {
+		legacy, _ := filepath.Glob(legacyTempFilePattern)
+		for _, path := range legacy {
+			if info, err := os.Lstat(path); err == nil && info.Mode().IsRegular() && isOwnedByCurrentUser(info) {
+				if os.Remove(path) == nil {
+					removed++
+				}
+			}
+		}
+	}
+	return removed
+}
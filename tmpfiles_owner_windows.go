@@ -0,0 +1,8 @@
+package main
+
+import "os"
+
+// files in the user's temporary directory are private on windows
+func isOwnedByCurrentUser(info os.FileInfo) bool {
+	return true
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andrew-d/go-termutil"
+	"github.com/siadat/eton/eton"
+)
+
+// retentionCommands are the commands that purge the notes removed before
+// the retention period. Reading commands do not write to the database, and
+// unrm and trash must still see the notes the user may want to recover.
+var retentionCommands = []string{
+	"new", "addfile", "edit", "rm", "remove", "mv", "move", "mark", "unmark",
+	"alias", "unalias", "tag", "untag", "import", "revert", "encrypt", "purge",
+}
+
+// runsRetention reports whether the command parsed in args purges expired
+// notes, see retentionCommands.
+func runsRetention(args map[string]interface{}, opts options) bool {
+	if opts.DryRun {
+		return false
+	}
+	for _, command := range retentionCommands {
+		if ran, ok := args[command].(bool); ok && ran {
+			return true
+		}
+	}
+	return false
+}
+
+// cmdTrash lists the removed notes, how long ago they were removed and their
+// sizes, revisions included.
+func cmdTrash(ctx context.Context, store eton.Store, w *tabwriter.Writer) bool {
+	items, err := store.Trash(ctx)
+	check(err)
+	if len(items) == 0 {
+		fmt.Fprintln(out, "trash is empty")
+		return true
+	}
+
+	var total int64
+	for _, item := range items {
+		attr := attrStruct{item.Attr}
+		age := formatAge(time.Since(attr.getDeletedAt()))
+		fmt.Fprintf(w, "%s\t%s ago\t%s\t%s\n", color(attr.getIdentifier(), themeColor("id")), age, formatSize(item.Size), attr.title())
+		total += item.Size
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "%d removed, %s", len(items), formatSize(total))
+	if retention := cfg.get("trash.retention"); len(retention) > 0 {
+		fmt.Fprintf(out, ", purged %s after removal", retention)
+	}
+	fmt.Fprintln(out)
+	return true
+}
+
+// cmdPurge deletes removed notes for good and reclaims their space.
+// Purging every removed note asks for confirmation, unless forced.
+func cmdPurge(ctx context.Context, store eton.Store, opts options) bool {
+	ids, err := purgeIDs(ctx, store, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(ids) == 0 && opts.OlderThan.IsZero() && !opts.Force {
+		items, err := store.Trash(ctx)
+		check(err)
+		if len(items) == 0 {
+			fmt.Fprintln(out, "trash is empty")
+			return true
+		}
+		if !confirm(fmt.Sprintf("purge %s for good? [y/N] ", pluralNotes(len(items)))) {
+			log.Fatal("aborted, use -f to purge every removed note")
+		}
+	}
+
+	purged, err := store.Purge(ctx, ids, opts.OlderThan)
+	check(err)
+	if purged == 0 {
+		fmt.Fprintln(out, "0 purged")
+		return true
+	}
+	reclaimed, err := store.Vacuum(ctx)
+	check(err)
+
+	fmt.Fprintf(out, "%d purged, %s reclaimed\n", purged, formatSize(reclaimed))
+	return true
+}
+
+// purgeIDs returns the IDs of the notes to purge given by ID or alias, it
+// fails if one of them is not in the trash.
+func purgeIDs(ctx context.Context, store eton.Store, opts options) ([]int64, error) {
+	items, err := store.Trash(ctx)
+	if err != nil {
+		return nil, err
+	}
+	removed := make(map[int64]bool, len(items))
+	for _, item := range items {
+		removed[item.ID.Int64] = true
+	}
+
+	ids := make([]int64, 0, len(opts.IDs)+len(opts.Aliases))
+	for _, id := range opts.IDs {
+		if !removed[id] {
+			return nil, fmt.Errorf("ID:%d is not in the trash, only removed notes are purged", id)
+		}
+		ids = append(ids, id)
+	}
+	for _, alias := range opts.Aliases {
+		// aliases of removed notes match exactly only
+		attr := attrFromStore(store.FindByAlias(ctx, alias, true))
+		if attr.getID() == -1 {
+			return nil, fmt.Errorf("alias \"%s\" not found", alias)
+		}
+		if !removed[attr.getID()] {
+			return nil, fmt.Errorf("%s is not in the trash, only removed notes are purged", alias)
+		}
+		ids = append(ids, attr.getID())
+	}
+	return ids, nil
+}
+
+// confirm asks a yes or no question on /dev/tty, false if there is no
+// terminal.
+func confirm(question string) bool {
+	if !termutil.Isatty(os.Stdin.Fd()) {
+		return false
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, question)
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// purgeExpired purges the notes removed before the retention period of the
+// config file, if there is one. It only runs before the commands that
+// change notes, see retentionCommands.
+func purgeExpired(ctx context.Context, store eton.Store, opts options) {
+	retention := cfg.get("trash.retention")
+	if len(retention) == 0 {
+		return
+	}
+	age, err := eton.ParseAge(retention)
+	if err != nil {
+		log.Fatalf("trash.retention: %v", err)
+	}
+
+	purged, err := store.Purge(ctx, nil, time.Now().Add(-age))
+	check(err)
+	if purged > 0 && opts.Verbose {
+		log.Printf("%d notes removed more than %s ago purged\n", purged, retention)
+	}
+}
+
+// formatAge formats a duration like the ages of time filters, e.g. 3d.
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 365*24*time.Hour:
+		return fmt.Sprintf("%dy", d/(365*24*time.Hour))
+	case d >= 7*24*time.Hour:
+		return fmt.Sprintf("%dw", d/(7*24*time.Hour))
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	default:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+}
+
+// formatSize formats a number of bytes, e.g. 12.5 KiB.
+func formatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, unit := float64(size)/1024, "KiB"
+	for _, next := range []string{"MiB", "GiB"} {
+		if value < 1024 {
+			break
+		}
+		value, unit = value/1024, next
+	}
+	return fmt.Sprintf("%.1f %s", value, unit)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPurgeIDs(t *testing.T) {
+	ctx, store := openTestStore(t)
+	live := createNote(t, ctx, store, "keep", "live")
+	removed := createNote(t, ctx, store, "drop", "gone")
+	if _, err := store.Remove(ctx, removed, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts options
+		want []int64
+		err  bool
+	}{
+		{options{}, []int64{}, false},
+		{options{IDs: []int64{removed}}, []int64{removed}, false},
+		{options{Aliases: []string{"gone"}}, []int64{removed}, false},
+		{options{IDs: []int64{live}}, nil, true},
+		{options{Aliases: []string{"live"}}, nil, true},
+		{options{Aliases: []string{"nothing"}}, nil, true},
+		{options{IDs: []int64{removed, 42}}, nil, true},
+	}
+	for _, test := range tests {
+		ids, err := purgeIDs(ctx, store, test.opts)
+		if (err != nil) != test.err || fmt.Sprint(ids) != fmt.Sprint(test.want) {
+			t.Errorf("purgeIDs(%+v) = %v, %v, want %v, error %v", test.opts, ids, err, test.want, test.err)
+		}
+	}
+}